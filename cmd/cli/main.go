@@ -18,7 +18,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/pkg/errors"
@@ -28,9 +31,12 @@ import (
 
 	"github.com/kbrew-dev/kbrew/pkg/apps"
 	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/kube"
 	"github.com/kbrew-dev/kbrew/pkg/log"
 	"github.com/kbrew-dev/kbrew/pkg/registry"
+	"github.com/kbrew-dev/kbrew/pkg/release"
 	"github.com/kbrew-dev/kbrew/pkg/update"
+	"github.com/kbrew-dev/kbrew/pkg/util"
 	"github.com/kbrew-dev/kbrew/pkg/version"
 )
 
@@ -41,6 +47,17 @@ var (
 	namespace  string
 	timeout    string
 	debug      bool
+	atomic     bool
+	dryRun     bool
+	keepDeps   bool
+	cascade    bool
+	resume     bool
+	ref        string
+	parallel   int
+
+	setValues       []string
+	setStringValues []string
+	valuesFiles     []string
 
 	rootCmd = &cobra.Command{
 		Use:           "kbrew",
@@ -82,6 +99,15 @@ var (
 		},
 	}
 
+	upgradeCmd = &cobra.Command{
+		Use:   "upgrade [NAME]",
+		Short: "Upgrade application",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return manageApp(apps.Upgrade, args)
+		},
+	}
+
 	searchCmd = &cobra.Command{
 		Use:   "search [NAME]",
 		Short: "Search application",
@@ -103,13 +129,204 @@ var (
 				return nil
 			}
 			fmt.Println("Available recipes:")
+			// Recipes are ordered by the registry priority, the first one with a name is used for installs
+			resolved := map[string]registry.Info{}
+			shadowed := []registry.Info{}
 			for _, app := range appList {
+				if _, ok := resolved[app.Name]; ok {
+					shadowed = append(shadowed, app)
+					continue
+				}
+				resolved[app.Name] = app
 				fmt.Println(app.Name)
 			}
+			logger := log.NewLogger(debug)
+			for _, app := range shadowed {
+				logger.Warnf("Recipe %s from %s registry is shadowed by the recipe from %s registry, use %s to install it", app.Name, app.Registry, resolved[app.Name].Registry, app.QualifiedName())
+			}
+			return nil
+		},
+	}
+
+	templateCmd = &cobra.Command{
+		Use:   "template [NAME]",
+		Short: "Render manifests of the application and its dependencies locally",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			appName, configFile, err := fetchRecipe(reg, args[0])
+			if err != nil {
+				return err
+			}
+			overrides, err := config.ParseOverrides(setValues, setStringValues, valuesFiles)
+			if err != nil {
+				return err
+			}
+			rendered, err := apps.Render(appName, namespace, configFile, overrides)
+			if err != nil {
+				return err
+			}
+			return apps.WriteManifests(os.Stdout, rendered)
+		},
+	}
+
+	diffCmd = &cobra.Command{
+		Use:   "diff [NAME]",
+		Short: "Show changes the application installation would make to the cluster",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			appName, configFile, err := fetchRecipe(reg, args[0])
+			if err != nil {
+				return err
+			}
+			overrides, err := config.ParseOverrides(setValues, setStringValues, valuesFiles)
+			if err != nil {
+				return err
+			}
+			return apps.Diff(context.Background(), appName, namespace, configFile, overrides, os.Stdout)
+		},
+	}
+
+	depsCmd = &cobra.Command{
+		Use:   "deps [NAME]",
+		Short: "Print the dependency tree of the application",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			appName, configFile, err := fetchRecipe(reg, args[0])
+			if err != nil {
+				return err
+			}
+			g, err := apps.BuildGraph(appName, configFile)
+			if err != nil {
+				return err
+			}
+			fmt.Print(g)
+			return nil
+		},
+	}
+
+	lintCmd = &cobra.Command{
+		Use:   "lint [PATH|NAME]",
+		Short: "Check recipes for errors",
+		Long: `Check recipes for errors. The argument can be a recipe file, a dir of recipes or the name of an app in the registries.
+Recipes are checked against the schema, dependency recipes must exist, templates and manifests must render and
+args of raw and kustomize apps must match the objects in the manifest.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintRecipes(args[0])
+		},
+	}
+
+	recipeCmd = &cobra.Command{
+		Use:   "recipe",
+		Short: "Helpers for writing kbrew recipes",
+	}
+
+	hashCmd = &cobra.Command{
+		Use:   "hash [NAME|URL|FILE]",
+		Short: "Compute sha256 digest of the application manifest or chart archive to be set in the recipe",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			digest, err := recipeDigest(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(digest)
 			return nil
 		},
 	}
 
+	registryCmd = &cobra.Command{
+		Use:   "registry",
+		Short: "Manage recipe registries",
+	}
+
+	registryAddCmd = &cobra.Command{
+		Use:   "add [USER/REPO|URL]",
+		Short: "Add a recipe registry from GitHub USER/REPO or a git URL",
+		Long: `Add a recipe registry from GitHub USER/REPO or a git URL, e.g https, ssh or file URL of a repo on any git host.
+Use --ref to pin the registry to a branch, tag or commit, kbrew update then follows the pinned branch or stays at the tag or commit.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			_, err = reg.Add(args[0], ref)
+			return err
+		},
+	}
+
+	registryRemoveCmd = &cobra.Command{
+		Use:   "remove [NAME]",
+		Short: "Remove a recipe registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			if err := reg.Remove(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Registry %s removed\n", args[0])
+			return nil
+		},
+	}
+
+	registryListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List recipe registries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRegistries()
+		},
+	}
+
+	registryInfoCmd = &cobra.Command{
+		Use:   "info [NAME]",
+		Short: "Describe a recipe registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reg, err := registry.New(config.ConfigDir)
+			if err != nil {
+				return err
+			}
+			r, err := reg.Get(args[0])
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			fmt.Fprintf(w, "Name:\t%s\n", r.Name)
+			fmt.Fprintf(w, "URL:\t%s\n", r.URL)
+			if r.Ref != "" {
+				fmt.Fprintf(w, "Ref:\t%s\n", r.Ref)
+			}
+			fmt.Fprintf(w, "Path:\t%s\n", r.Path)
+			fmt.Fprintf(w, "Head:\t%s\n", r.Head)
+			fmt.Fprintf(w, "Recipes:\t%d\n", r.Recipes)
+			return w.Flush()
+		},
+	}
+
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List applications installed by kbrew",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listReleases()
+		},
+	}
+
 	updateCmd = &cobra.Command{
 		Use:   "update",
 		Short: "Update kbrew and recipe registries",
@@ -182,17 +399,11 @@ var (
 			if err != nil {
 				return err
 			}
-			appArgs, err := reg.Args(args[0])
+			app, err := reg.Args(args[0])
 			if err != nil {
 				return err
 			}
-
-			bytes, err := yaml.Marshal(appArgs)
-			if err != nil {
-				return err
-			}
-			fmt.Println(string(bytes))
-			return nil
+			return printArgs(app)
 		},
 	}
 )
@@ -200,22 +411,53 @@ var (
 func init() {
 	cobra.OnInitialize(config.InitConfig)
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file (default is $HOME/.kbrew.yaml)")
-	rootCmd.PersistentFlags().StringVarP(&config.ConfigDir, "config-dir", "", "", "config dir (default is $HOME/.kbrew)")
+	rootCmd.PersistentFlags().StringVarP(&config.ConfigDir, "config-dir", "", "", "config dir (default is $KBREW_HOME or $HOME/.kbrew)")
 	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "namespace")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "", false, "enable debug logs")
 
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(installCmd)
 	rootCmd.AddCommand(removeCmd)
+	rootCmd.AddCommand(upgradeCmd)
 	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(diffCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(analyticsCmd)
 	rootCmd.AddCommand(completionCmd)
 	rootCmd.AddCommand(infoCmd)
 
+	rootCmd.AddCommand(recipeCmd)
+	rootCmd.AddCommand(lintCmd)
+	rootCmd.AddCommand(depsCmd)
+	rootCmd.AddCommand(registryCmd)
+
 	infoCmd.AddCommand(argsCmd)
+	recipeCmd.AddCommand(hashCmd)
+	registryCmd.AddCommand(registryAddCmd)
+	registryAddCmd.Flags().StringVarP(&ref, "ref", "", "", "branch, tag or commit to pin the registry to (default is the default branch of the repo)")
+	registryCmd.AddCommand(registryRemoveCmd)
+	registryCmd.AddCommand(registryListCmd)
+	registryCmd.AddCommand(registryInfoCmd)
 
 	installCmd.PersistentFlags().StringVarP(&timeout, "timeout", "t", "", "time to wait for app components to be in a ready state (default 15m0s)")
+	installCmd.PersistentFlags().BoolVarP(&atomic, "atomic", "", false, "remove the apps installed by the command if the installation fails")
+	installCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "print the execution plan without making any changes to the cluster")
+	installCmd.PersistentFlags().BoolVarP(&resume, "resume", "", false, "skip the apps and steps completed by the previous interrupted install")
+	removeCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "print the execution plan without making any changes to the cluster")
+	removeCmd.PersistentFlags().BoolVarP(&keepDeps, "keep-deps", "", false, "remove only the given apps and leave their dependency apps installed")
+	removeCmd.PersistentFlags().BoolVarP(&cascade, "cascade", "", false, "remove the dependency apps even if other installed apps still depend on them")
+	upgradeCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "print the execution plan without making any changes to the cluster")
+	upgradeCmd.PersistentFlags().StringVarP(&timeout, "timeout", "t", "", "time to wait for app components to be in a ready state (default 15m0s)")
+	for _, cmd := range []*cobra.Command{installCmd, upgradeCmd} {
+		cmd.PersistentFlags().IntVar(&parallel, "parallelism", 1, "maximum number of apps installed concurrently, apps in the same pre-install or post-install phase are installed concurrently if greater than 1")
+	}
+	for _, cmd := range []*cobra.Command{installCmd, upgradeCmd, templateCmd, diffCmd} {
+		cmd.PersistentFlags().StringArrayVar(&setValues, "set", nil, "override a recipe arg, the value is parsed as YAML (can specify multiple: --set key1=val1 --set key2=val2)")
+		cmd.PersistentFlags().StringArrayVar(&setStringValues, "set-string", nil, "override a recipe arg with a string value (can specify multiple)")
+		cmd.PersistentFlags().StringArrayVarP(&valuesFiles, "values", "f", nil, "override recipe args with the args in a YAML file (can specify multiple)")
+	}
 }
 
 func main() {
@@ -231,6 +473,17 @@ func Execute() {
 }
 
 func manageApp(m apps.Method, args []string) error {
+	overrides, err := config.ParseOverrides(setValues, setStringValues, valuesFiles)
+	if err != nil {
+		return err
+	}
+	opts := apps.Options{Atomic: atomic, Overrides: overrides, KeepDeps: keepDeps, Cascade: cascade, Parallelism: parallel, Resume: resume}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if dryRun {
+		return planApp(m, args, opts)
+	}
 	ctx := context.Background()
 	if timeout == "" {
 		timeout = defaultTimeout
@@ -239,27 +492,64 @@ func manageApp(m apps.Method, args []string) error {
 	if err != nil {
 		return err
 	}
+	clis, err := kube.NewClient()
+	if err != nil {
+		return err
+	}
+	releases := release.NewStore(clis.KubeCli)
 	for _, a := range args {
 		reg, err := registry.New(config.ConfigDir)
 		if err != nil {
 			return err
 		}
-		configFile, err := reg.FetchRecipe(strings.ToLower(a))
+		appName, configFile, err := fetchRecipe(reg, a)
 		if err != nil {
 			return err
 		}
 		logger := log.NewLogger(debug)
-		runner := apps.NewAppRunner(m, logger, log.NewStatus(logger))
-		c, err := config.NewApp(strings.ToLower(a), configFile)
+		runner := apps.NewAppRunner(m, logger, log.NewProgress(logger), releases, opts)
+		c, err := config.NewApp(appName, configFile)
 		if err != nil {
 			return err
 		}
-		printDetails(logger, strings.ToLower(a), m, c)
+		printDetails(logger, appName, m, c)
 		ctxTimeout, cancel := context.WithTimeout(ctx, timeoutDur)
 		defer cancel()
-		if err := runner.Run(ctxTimeout, strings.ToLower(a), namespace, configFile); err != nil {
+		if err := runner.Run(ctxTimeout, appName, namespace, configFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planApp prints the actions the operation would perform on the apps without making any changes
+func planApp(m apps.Method, args []string, opts apps.Options) error {
+	reg, err := registry.New(config.ConfigDir)
+	if err != nil {
+		return err
+	}
+	logger := log.NewLogger(debug)
+	// Release records are needed to find the dependency apps still required by other apps on uninstall
+	// and the arg overrides recorded at the previous install on upgrade
+	var releases *release.Store
+	if m == apps.Uninstall || m == apps.Upgrade {
+		clis, err := kube.NewClient()
+		if err != nil {
 			return err
 		}
+		releases = release.NewStore(clis.KubeCli)
+	}
+	for _, a := range args {
+		appName, configFile, err := fetchRecipe(reg, a)
+		if err != nil {
+			return err
+		}
+		plan, err := apps.NewAppRunner(m, logger, nil, releases, opts).Plan(appName, namespace, configFile)
+		if err != nil {
+			return err
+		}
+		logger.Infof("📝 Execution plan to %s %s app:", m, appName)
+		fmt.Print(plan)
 	}
 	return nil
 }
@@ -282,6 +572,21 @@ func printDetails(log *log.Logger, appName string, m apps.Method, c *config.AppC
 			}
 		}
 		log.Info("---")
+	case apps.Upgrade:
+		log.Infof("⬆️  Upgrading %s app...", appName)
+		log.InfoMap("Version", c.App.Version)
+		log.InfoMap("Dependencies", "")
+		for _, pre := range c.App.PreInstall {
+			for _, app := range pre.Apps {
+				log.Infof(" - %s", app)
+			}
+		}
+		for _, post := range c.App.PostInstall {
+			for _, app := range post.Apps {
+				log.Infof(" - %s", app)
+			}
+		}
+		log.Info("---")
 	case apps.Uninstall:
 		log.Infof("🧹 Uninstalling %s app and its dependencies...", appName)
 		log.InfoMap("Dependencies", "")
@@ -300,6 +605,191 @@ func printDetails(log *log.Logger, appName string, m apps.Method, c *config.AppC
 
 }
 
+// lintRecipes lints the recipe file, all the recipes in the dir or the recipe of the app in the registries
+func lintRecipes(arg string) error {
+	recipes := map[string]string{}
+	fi, err := os.Stat(arg)
+	switch {
+	case err == nil && fi.IsDir():
+		files, err := filepath.Glob(filepath.Join(arg, "*.yaml"))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			recipes[strings.TrimSuffix(filepath.Base(f), ".yaml")] = f
+		}
+	case err == nil:
+		recipes[strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))] = arg
+	default:
+		reg, err := registry.New(config.ConfigDir)
+		if err != nil {
+			return err
+		}
+		appName, configFile, err := fetchRecipe(reg, arg)
+		if err != nil {
+			return err
+		}
+		recipes[appName] = configFile
+	}
+
+	names := make([]string, 0, len(recipes))
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Dependency recipes are linted along with the app, report the issues only once
+	reported := map[apps.LintIssue]struct{}{}
+	for _, name := range names {
+		for _, issue := range apps.Lint(name, recipes[name]) {
+			if _, ok := reported[issue]; ok {
+				continue
+			}
+			reported[issue] = struct{}{}
+			fmt.Fprintln(os.Stderr, issue)
+		}
+	}
+	count := len(reported)
+	if count != 0 {
+		return errors.Errorf("%d issue(s) found in %d recipe(s)", count, len(recipes))
+	}
+	fmt.Printf("%d recipe(s) linted, no issues found\n", len(recipes))
+	return nil
+}
+
+// recipeDigest returns the sha256 digest of the URL or the file.
+// If the arg is neither, it is looked up as an app name in the registries.
+func recipeDigest(arg string) (string, error) {
+	if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+		return util.Digest(arg)
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return util.Digest(arg)
+	}
+	reg, err := registry.New(config.ConfigDir)
+	if err != nil {
+		return "", err
+	}
+	appName, configFile, err := fetchRecipe(reg, arg)
+	if err != nil {
+		return "", err
+	}
+	return apps.Digest(appName, configFile)
+}
+
+// fetchRecipe returns the app name and path of the app recipe. The name may be qualified with the registry
+// as USER/REPO/APP to use the recipe from that registry.
+func fetchRecipe(reg *registry.KbrewRegistry, name string) (string, string, error) {
+	name = strings.ToLower(name)
+	configFile, err := reg.FetchRecipe(name)
+	if err != nil {
+		return "", "", err
+	}
+	return registry.AppName(name), configFile, nil
+}
+
+// printArgs prints the args of the recipe with their spec, default values are the recipe args if set
+func printArgs(app *config.App) error {
+	keys := []string{}
+	for k := range app.Args {
+		keys = append(keys, k)
+	}
+	for k := range app.ArgsSpec {
+		if _, ok := app.Args[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tDEFAULT\tREQUIRED\tDESCRIPTION")
+	for _, k := range keys {
+		spec := app.ArgsSpec[k]
+		def, ok := app.Args[k]
+		if !ok {
+			def = spec.Default
+		}
+		defStr := ""
+		if def != nil {
+			b, err := yaml.Marshal(config.Normalize(def))
+			if err != nil {
+				return err
+			}
+			defStr = strings.TrimSpace(string(b))
+			if strings.Contains(defStr, "\n") {
+				defStr = "<complex>"
+			}
+		}
+		desc := spec.Description
+		if len(spec.Enum) != 0 {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (one of: %s)", desc, config.FormatEnum(spec.Enum)))
+		}
+		if spec.Pattern != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (pattern: %s)", desc, spec.Pattern))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", k, spec.Type, defStr, spec.Required, desc)
+	}
+	return w.Flush()
+}
+
+// listRegistries prints the registries with their HEAD commit and number of recipes
+func listRegistries() error {
+	reg, err := registry.New(config.ConfigDir)
+	if err != nil {
+		return err
+	}
+	names, err := reg.List()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREF\tHEAD\tRECIPES\tURL")
+	for _, name := range names {
+		r, err := reg.Get(name)
+		if err != nil {
+			return err
+		}
+		pin := r.Ref
+		if pin == "" {
+			pin = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", r.Name, pin, shortCommit(r.Head), r.Recipes, r.URL)
+	}
+	return w.Flush()
+}
+
+func listReleases() error {
+	clis, err := kube.NewClient()
+	if err != nil {
+		return err
+	}
+	releases, err := release.NewStore(clis.KubeCli).List(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		fmt.Println("No apps installed by kbrew.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tNAMESPACE\tREGISTRY\tCOMMIT\tSTATUS\tUPDATED")
+	for _, rel := range releases {
+		ns := rel.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rel.Name, rel.Version, ns, rel.Registry, shortCommit(rel.RecipeCommit), rel.Status, rel.UpdatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// shortCommit returns the abbreviated git commit hash
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
 func manageAnalytics(args []string) error {
 	if len(args) == 0 {
 		return errors.New("Missing subcommand")
@@ -20,15 +20,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/kbrew-dev/kbrew/pkg/apps/helm"
+	"github.com/kbrew-dev/kbrew/pkg/apps/kustomize"
 	"github.com/kbrew-dev/kbrew/pkg/apps/raw"
 	"github.com/kbrew-dev/kbrew/pkg/config"
 	"github.com/kbrew-dev/kbrew/pkg/events"
 	"github.com/kbrew-dev/kbrew/pkg/log"
+	"github.com/kbrew-dev/kbrew/pkg/registry"
+	"github.com/kbrew-dev/kbrew/pkg/release"
 )
 
 // Method defines operation performed on the apps
@@ -39,48 +45,223 @@ const (
 	Install Method = "install"
 	// Uninstall method to uninstall the app
 	Uninstall Method = "uninstall"
+	// Upgrade method to upgrade the app
+	Upgrade Method = "upgrade"
 )
 
+// progressive returns the verb form of the method used in the log messages
+func (m Method) progressive() string {
+	switch m {
+	case Uninstall:
+		return "uninstalling"
+	case Upgrade:
+		return "upgrading"
+	default:
+		return "installing"
+	}
+}
+
 // App represents a K8s applications than can be managed with kbrew recipes
 type App interface {
 	Install(ctx context.Context, name, namespace string, version string, opt map[string]string) error
+	Upgrade(ctx context.Context, name, namespace string, version string, opt map[string]string) error
 	Uninstall(ctx context.Context, name, namespace string) error
 	Search(ctx context.Context, name string) (string, error)
 	Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error)
+	// Exists checks if the app, or any of its objects, is present in the namespace
+	Exists(ctx context.Context, name, namespace string) (bool, error)
+}
+
+// Options holds the optional settings of AppRunner
+type Options struct {
+	// Atomic uninstalls the apps installed by the run if the installation fails
+	Atomic bool
+	// Overrides replace the recipe args of the apps passed to Run, dependency apps use their recipe args.
+	// On upgrade, overrides recorded in the release at the previous install or upgrade are applied first.
+	Overrides map[string]interface{}
+	// KeepDeps uninstalls only the apps passed to Run and leaves their dependency apps installed
+	KeepDeps bool
+	// Cascade uninstalls the dependency apps even if other installed apps still depend on them
+	Cascade bool
+	// Resume skips the apps and steps completed by the previous interrupted install of the app
+	Resume bool
+	// Parallelism is the maximum number of apps installed concurrently. Apps in the same pre-install or
+	// post-install phase are installed concurrently only if it is greater than 1.
+	Parallelism int
+}
+
+// Validate checks the options for conflicting settings
+func (o Options) Validate() error {
+	if o.KeepDeps && o.Cascade {
+		return errors.New("keep-deps and cascade options cannot be used together")
+	}
+	return nil
 }
 
 type AppRunner struct {
 	operation Method
 	log       *log.Logger
-	status    *log.Status
+	status    *log.Progress
+	releases  *release.Store
+	opts      Options
+	// newApp returns the App operating on the app declared in the recipe
+	newApp func(c config.App, log *log.Logger) (App, error)
+
+	// mu guards completed and done which are updated by the apps installed concurrently
+	mu sync.Mutex
+	// completed holds the apps and steps executed by the run in order
+	completed []completedItem
+	// done holds the apps processed by the run keyed by the recipe path
+	done map[string]*appRun
+	// slots limits the number of apps installed concurrently
+	slots chan struct{}
+	// journal records the apps and steps completed by the install run, it is nil for the other operations
+	journal *journal
+	// removing holds the names of the apps being uninstalled by the run, from the app passed to Run
+	// to the current dependency
+	removing []string
+}
+
+// appRun is the result of processing an app, shared by the recipes depending on the same app
+type appRun struct {
+	finished chan struct{}
+	err      error
 }
 
-func NewAppRunner(op Method, log *log.Logger, status *log.Status) *AppRunner {
+// NewAppRunner returns AppRunner which records installed apps in the release store.
+// Release records are not maintained if releases is nil.
+func NewAppRunner(op Method, log *log.Logger, status *log.Progress, releases *release.Store, opts Options) *AppRunner {
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
 	return &AppRunner{
 		operation: op,
 		log:       log,
 		status:    status,
+		releases:  releases,
+		opts:      opts,
+		newApp:    newApp,
+		done:      map[string]*appRun{},
+		slots:     make(chan struct{}, parallelism),
 	}
 }
 
 // Run fetches recipe from registry for the app and performs given operation
 func (r *AppRunner) Run(ctx context.Context, appName, namespace, appConfigPath string) error {
-	c, err := config.NewApp(appName, appConfigPath)
-	if err != nil {
+	// Check the dependency graph and validate args of the app and all its dependencies
+	// before making any changes to the cluster
+	if _, err := r.Plan(appName, namespace, appConfigPath); err != nil {
 		return err
 	}
-	var app App
+	if r.operation == Install {
+		r.journal = r.openJournal(appName, namespace)
+	}
+	err := r.runApp(ctx, appName, namespace, appConfigPath, "")
+	switch {
+	case err != nil && r.opts.Atomic && r.operation == Install:
+		r.rollback()
+		r.removeJournal()
+	case err != nil && r.journal != nil:
+		r.log.Infof("Completed apps and steps are recorded in %s, install again with --resume to skip them", r.journal.path)
+	default:
+		r.removeJournal()
+	}
+	return err
+}
 
-	switch c.App.Repository.Type {
-	case config.Helm:
-		app = helm.New(c.App, r.log)
-	case config.Raw:
-		app, err = raw.New(c.App, r.log)
+// openJournal returns the journal of the install run. The journal of the previous run is loaded if the run is resumed.
+// Journals are not maintained if the kbrew config dir is not set.
+func (r *AppRunner) openJournal(appName, namespace string) *journal {
+	if config.ConfigDir == "" {
+		return nil
+	}
+	dir := filepath.Join(config.ConfigDir, config.JournalsDirName)
+	if r.opts.Resume {
+		j, err := loadJournal(dir, appName, namespace)
+		if err == nil {
+			r.log.Infof("Resuming the install of %s, %d completed apps and steps will be skipped", appName, len(j.Completed))
+			return j
+		}
+		if errors.Is(err, errJournalNotFound) {
+			r.log.Infof("No interrupted install of %s found, starting a new install", appName)
+		} else {
+			r.log.Warnf("%s, starting a new install", err.Error())
+		}
+	}
+	return newJournal(dir, r.operation, appName, namespace)
+}
+
+// record adds the completed app or step to the journal
+func (r *AppRunner) record(key string) {
+	if err := r.journal.record(key); err != nil {
+		r.log.Warnf("Failed to record progress of the install. %s", err.Error())
+	}
+}
+
+// removeJournal deletes the journal once the install does not need to be resumed
+func (r *AppRunner) removeJournal() {
+	if err := r.journal.remove(); err != nil {
+		r.log.Warnf("%s", err.Error())
+	}
+}
+
+// runApp performs the operation on the app once per run. Apps shared by multiple recipes are processed
+// only once, the later runs wait for the first one to finish and return its result.
+func (r *AppRunner) runApp(ctx context.Context, appName, namespace, appConfigPath, parent string) error {
+	r.mu.Lock()
+	if ar, ok := r.done[appConfigPath]; ok {
+		r.mu.Unlock()
+		<-ar.finished
+		return ar.err
+	}
+	ar := &appRun{finished: make(chan struct{})}
+	r.done[appConfigPath] = ar
+	r.mu.Unlock()
+
+	ar.err = r.run(ctx, appName, namespace, appConfigPath, parent)
+	close(ar.finished)
+	return ar.err
+}
+
+// runDependencies runs the operation on the apps of a pre-install or post-install phase.
+// With parallelism enabled, apps are installed concurrently and the first error is returned once all of them finish.
+func (r *AppRunner) runDependencies(ctx context.Context, apps []string, namespace, appConfigPath, parent string) error {
+	if r.opts.Parallelism < 2 || r.operation == Uninstall {
+		for _, a := range apps {
+			if err := r.runApp(ctx, a, namespace, dependencyPath(appConfigPath, a), parent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, len(apps))
+	var wg sync.WaitGroup
+	for i, a := range apps {
+		wg.Add(1)
+		go func(i int, a string) {
+			defer wg.Done()
+			errs[i] = r.runApp(ctx, a, namespace, dependencyPath(appConfigPath, a), parent)
+		}(i, a)
+	}
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("unsupported app type %s", c.App.Repository.Type)
+	}
+	return nil
+}
+
+// parent is the name of the app which declares the app as dependency, it is empty for the app passed to Run
+func (r *AppRunner) run(ctx context.Context, appName, namespace, appConfigPath, parent string) error {
+	c, err := config.NewApp(appName, appConfigPath)
+	if err != nil {
+		return err
+	}
+	app, err := r.newApp(c.App, r.log)
+	if err != nil {
+		return err
 	}
 
 	// Check if entry exists in config
@@ -91,19 +272,39 @@ func (r *AppRunner) Run(ctx context.Context, appName, namespace, appConfigPath s
 		}
 	}
 
-	// Override if default namespace is set
-	if c.App.Namespace != "" {
-		namespace = c.App.Namespace
-	}
-	if c.App.Namespace == "-" {
-		namespace = ""
-	}
+	namespace = resolveNamespace(c, namespace)
 
 	switch r.operation {
-	case Install:
-		return r.runInstall(ctx, app, c, appName, namespace, appConfigPath)
+	case Install, Upgrade:
+		var overrides map[string]interface{}
+		if parent == "" {
+			overrides = r.overrides(appName, namespace)
+		}
+		if err := c.App.ResolveArgs(overrides); err != nil {
+			return err
+		}
+		err = r.runInstall(ctx, app, c, appName, namespace, appConfigPath)
+		r.saveRelease(c, appName, namespace, appConfigPath, parent, overrides, err)
+		return err
 	case Uninstall:
-		return r.runUninstall(ctx, app, c, appName, namespace, appConfigPath)
+		if users := r.requiredBy(appName, namespace); len(users) > 0 {
+			if parent != "" {
+				r.log.Infof("Keeping app %s in %s namespace, it is still required by %s", appName, namespace, strings.Join(users, ", "))
+				// Let the other apps depending on it reconsider the removal
+				r.mu.Lock()
+				delete(r.done, appConfigPath)
+				r.mu.Unlock()
+				return nil
+			}
+			r.log.Warnf("App %s is still required by %s", appName, strings.Join(users, ", "))
+		}
+		r.removing = append(r.removing, appName)
+		defer func() { r.removing = r.removing[:len(r.removing)-1] }()
+		if err = r.runUninstall(ctx, app, c, appName, namespace, appConfigPath); err != nil {
+			return err
+		}
+		r.deleteRelease(appName, namespace)
+		return nil
 	default:
 		err = fmt.Errorf("unsupported method %s", r.operation)
 	}
@@ -115,49 +316,80 @@ func (r *AppRunner) runInstall(ctx context.Context, app App, c *config.AppConfig
 	event := events.NewKbrewEvent(c)
 
 	// Run preinstall
-	r.status.Start(fmt.Sprintf("Setting up pre-install dependencies for %s", appName))
-	for _, phase := range c.App.PreInstall {
-		for _, a := range phase.Apps {
-			if err := r.Run(ctx, a, namespace, filepath.Join(filepath.Dir(appConfigPath), a+".yaml")); err != nil {
-				return r.handleInstallError(ctx, err, event, app, appName, namespace)
-			}
+	r.status.Start(appName, fmt.Sprintf("Setting up pre-install dependencies for %s", appName))
+	for i, phase := range c.App.PreInstall {
+		if err := r.runDependencies(ctx, phase.Apps, namespace, appConfigPath, appName); err != nil {
+			r.trackApp(app, c, appName, namespace, false)
+			return r.handleInstallError(ctx, err, event, app, appName, namespace)
 		}
-		for _, a := range phase.Steps {
+		for j, a := range phase.Steps {
+			key := stepKey(appName, PreInstallPhase, i, j, a)
+			if r.journal.done(key) {
+				r.log.Debugf("Skipping pre-install step of %s completed by the previous run", appName)
+				continue
+			}
 			out, err := r.execCommand(ctx, a)
+			r.trackStep(appName, a)
 			if err != nil {
+				r.trackApp(app, c, appName, namespace, false)
 				return r.handleInstallError(ctx, err, event, app, appName, namespace)
 			}
 			r.log.Debug(out)
+			r.record(key)
 		}
 	}
-	r.status.Stop()
-
-	// Run install
-	r.status.Start(fmt.Sprintf("Installing app %s in %s namespace", appName, namespace))
-	if err := app.Install(ctx, appName, namespace, c.App.Version, nil); err != nil {
-		return r.handleInstallError(ctx, err, event, app, appName, namespace)
+	r.status.Stop(appName)
+
+	// Run install or upgrade
+	if r.journal.done(appKey(appName, namespace)) {
+		r.log.Infof("Skipping app %s installed by the previous run", appName)
+	} else {
+		var err error
+		r.trackApp(app, c, appName, namespace, true)
+		r.slots <- struct{}{}
+		if r.operation == Upgrade {
+			r.status.Start(appName, fmt.Sprintf("Upgrading app %s in %s namespace", appName, namespace))
+			err = app.Upgrade(ctx, appName, namespace, c.App.Version, nil)
+		} else {
+			r.status.Start(appName, fmt.Sprintf("Installing app %s in %s namespace", appName, namespace))
+			err = app.Install(ctx, appName, namespace, c.App.Version, nil)
+		}
+		<-r.slots
+		if err != nil {
+			return r.handleInstallError(ctx, err, event, app, appName, namespace)
+		}
+		r.status.Success(appName)
+		r.record(appKey(appName, namespace))
 	}
-	r.status.Success()
 
 	// Run postinstall
-	r.status.Start(fmt.Sprintf("Setting up post-install dependencies for %s", appName))
-	for _, phase := range c.App.PostInstall {
-		for _, a := range phase.Apps {
-			if err := r.Run(ctx, a, namespace, filepath.Join(filepath.Dir(appConfigPath), a+".yaml")); err != nil {
-				return r.handleInstallError(ctx, err, event, app, appName, namespace)
-			}
+	r.status.Start(appName, fmt.Sprintf("Setting up post-install dependencies for %s", appName))
+	for i, phase := range c.App.PostInstall {
+		if err := r.runDependencies(ctx, phase.Apps, namespace, appConfigPath, appName); err != nil {
+			return r.handleInstallError(ctx, err, event, app, appName, namespace)
 		}
-		for _, a := range phase.Steps {
+		for j, a := range phase.Steps {
+			key := stepKey(appName, PostInstallPhase, i, j, a)
+			if r.journal.done(key) {
+				r.log.Debugf("Skipping post-install step of %s completed by the previous run", appName)
+				continue
+			}
 			out, err := r.execCommand(ctx, a)
+			r.trackStep(appName, a)
 			if err != nil {
 				return r.handleInstallError(ctx, err, event, app, appName, namespace)
 			}
 			r.log.Debug(out)
+			r.record(key)
 		}
 	}
-	r.status.Stop()
+	r.status.Stop(appName)
 	if viper.GetBool(config.AnalyticsEnabled) {
-		if err1 := event.Report(context.TODO(), events.ECInstallSuccess, nil, nil); err1 != nil {
+		eventType := events.ECInstallSuccess
+		if r.operation == Upgrade {
+			eventType = events.ECUpgradeSuccess
+		}
+		if err1 := event.Report(context.TODO(), eventType, nil, nil); err1 != nil {
 			r.log.Debugf("Failed to report event. %s", err1.Error())
 		}
 	}
@@ -168,7 +400,12 @@ func (r *AppRunner) runUninstall(ctx context.Context, app App, c *config.AppConf
 	// Event report
 	event := events.NewKbrewEvent(c)
 
-	r.status.Start(fmt.Sprintf("Executing up pre-cleanup steps for %s", appName))
+	preInstall, postInstall := c.App.PreInstall, c.App.PostInstall
+	if r.opts.KeepDeps {
+		preInstall, postInstall = nil, nil
+	}
+
+	r.status.Start(appName, fmt.Sprintf("Executing up pre-cleanup steps for %s", appName))
 	// Execute precleanup steps
 	for _, a := range c.App.PreCleanup.Steps {
 		out, err := r.execCommand(ctx, a)
@@ -177,35 +414,31 @@ func (r *AppRunner) runUninstall(ctx context.Context, app App, c *config.AppConf
 		}
 		r.log.Debug(out)
 	}
-	r.status.Stop()
+	r.status.Stop(appName)
 
 	// Delete postinstall apps
-	for _, phase := range c.App.PostInstall {
-		for _, a := range phase.Apps {
-			if err := r.Run(ctx, a, namespace, filepath.Join(filepath.Dir(appConfigPath), a+".yaml")); err != nil {
-				return r.handleUninstallError(ctx, err, event, appName, namespace)
-			}
+	for _, phase := range postInstall {
+		if err := r.runDependencies(ctx, phase.Apps, namespace, appConfigPath, appName); err != nil {
+			return r.handleUninstallError(ctx, err, event, appName, namespace)
 		}
 	}
 
 	// Run uninstall
-	r.status.Start(fmt.Sprintf("Removing app %s from %s namespace", appName, namespace))
+	r.status.Start(appName, fmt.Sprintf("Removing app %s from %s namespace", appName, namespace))
 	if err := app.Uninstall(ctx, appName, namespace); err != nil {
 		return r.handleUninstallError(ctx, err, event, appName, namespace)
 	}
-	r.status.Success()
+	r.status.Success(appName)
 
 	// Delete preinstall apps
-	for _, phase := range c.App.PreInstall {
-		for _, a := range phase.Apps {
-			if err := r.Run(ctx, a, namespace, filepath.Join(filepath.Dir(appConfigPath), a+".yaml")); err != nil {
-				return r.handleUninstallError(ctx, err, event, appName, namespace)
-			}
+	for _, phase := range preInstall {
+		if err := r.runDependencies(ctx, phase.Apps, namespace, appConfigPath, appName); err != nil {
+			return r.handleUninstallError(ctx, err, event, appName, namespace)
 		}
 	}
 
 	// Execute postcleanup steps
-	r.status.Start(fmt.Sprintf("Executing up post-cleanup steps for %s", appName))
+	r.status.Start(appName, fmt.Sprintf("Executing up post-cleanup steps for %s", appName))
 	for _, a := range c.App.PostCleanup.Steps {
 		out, err := r.execCommand(ctx, a)
 		if err != nil {
@@ -213,7 +446,7 @@ func (r *AppRunner) runUninstall(ctx context.Context, app App, c *config.AppConf
 		}
 		r.log.Debug(out)
 	}
-	r.status.Stop()
+	r.status.Stop(appName)
 
 	if viper.GetBool(config.AnalyticsEnabled) {
 		if err1 := event.Report(context.TODO(), events.ECUninstallSuccess, nil, nil); err1 != nil {
@@ -227,12 +460,15 @@ func (r *AppRunner) handleInstallError(ctx context.Context, err error, event *ev
 	if err == nil {
 		return nil
 	}
-	defer r.status.Error()
+	defer r.status.Error(appName)
 
-	eventType := events.ECInstallFail
+	eventType, timeoutEventType := events.ECInstallFail, events.ECInstallTimeout
+	if r.operation == Upgrade {
+		eventType, timeoutEventType = events.ECUpgradeFail, events.ECUpgradeTimeout
+	}
 	if ctx.Err() != nil && ctx.Err() == context.DeadlineExceeded {
-		r.log.Errorf("Timed out while installing %s app in %s namespace\n", appName, namespace)
-		eventType = events.ECInstallTimeout
+		r.log.Errorf("Timed out while %s %s app in %s namespace\n", r.operation.progressive(), appName, namespace)
+		eventType = timeoutEventType
 	}
 
 	if !viper.GetBool(config.AnalyticsEnabled) {
@@ -256,7 +492,7 @@ func (r *AppRunner) handleUninstallError(ctx context.Context, err error, event *
 	if err == nil {
 		return nil
 	}
-	defer r.status.Error()
+	defer r.status.Error(appName)
 	r.log.Warnf("Error encountered while uninstalling app - %s.\nYou need to cleanup few resources manually. App: %s, Namespace: %s\n", err, appName, namespace)
 	if !viper.GetBool(config.AnalyticsEnabled) {
 		return err
@@ -274,6 +510,165 @@ func (r *AppRunner) handleUninstallError(ctx context.Context, err error, event *
 	return err
 }
 
+// newApp returns the App of the recipe repository type
+func newApp(c config.App, log *log.Logger) (App, error) {
+	switch c.Repository.Type {
+	case config.Helm:
+		return helm.New(c, log), nil
+	case config.Raw:
+		app, err := raw.New(c, log)
+		if err != nil {
+			return nil, err
+		}
+		return app, nil
+	case config.Kustomize:
+		app, err := kustomize.New(c, log)
+		if err != nil {
+			return nil, err
+		}
+		return app, nil
+	default:
+		return nil, fmt.Errorf("unsupported app type %s", c.Repository.Type)
+	}
+}
+
+// resolveNamespace returns the namespace in which the app gets installed.
+// Namespace set in the recipe overrides the namespace passed by the user, "-" means the app is not namespaced.
+func resolveNamespace(c *config.AppConfig, namespace string) string {
+	if c.App.Namespace == "-" {
+		return ""
+	}
+	if c.App.Namespace != "" {
+		return c.App.Namespace
+	}
+	return namespace
+}
+
+// dependencyPath returns path of the recipe of a dependency app.
+// Dependency recipes are looked up in the same dir as the app recipe first, i.e in the registry of the app,
+// and then in all the registries in the priority order.
+func dependencyPath(appConfigPath, appName string) string {
+	path := filepath.Join(filepath.Dir(appConfigPath), appName+".yaml")
+	if _, err := os.Stat(path); err == nil || config.ConfigDir == "" {
+		return path
+	}
+	if p, err := registry.Lookup(config.ConfigDir, appName); err == nil {
+		return p
+	}
+	return path
+}
+
+// overrides returns the arg overrides for the app passed to Run, overrides do not apply to dependency apps.
+// On upgrade, overrides recorded in the release are reused and the new overrides take precedence over them.
+func (r *AppRunner) overrides(appName, namespace string) map[string]interface{} {
+	if r.operation != Upgrade || r.releases == nil {
+		return r.opts.Overrides
+	}
+	rel, err := r.releases.Get(context.Background(), appName, namespace)
+	if err != nil {
+		if err != release.ErrReleaseNotFound {
+			r.log.Warnf("Failed to read release record for %s. %s", appName, err.Error())
+		}
+		return r.opts.Overrides
+	}
+	return config.MergeArgs(rel.Overrides, r.opts.Overrides)
+}
+
+// saveRelease records the result of the app installation in the release store
+func (r *AppRunner) saveRelease(c *config.AppConfig, appName, namespace, appConfigPath, parent string, overrides map[string]interface{}, installErr error) {
+	if r.releases == nil {
+		return
+	}
+	// Use new context since ctx passed to Run might have been expired already
+	ctx := context.Background()
+	rel, err := r.releases.Get(ctx, appName, namespace)
+	if err != nil {
+		if err != release.ErrReleaseNotFound {
+			r.log.Warnf("Failed to read release record for %s. %s", appName, err.Error())
+			return
+		}
+		rel = &release.Release{Name: appName, Namespace: namespace}
+	}
+	rel.Version = c.App.Version
+	rel.Type = c.App.Repository.Type
+	rel.Args, _ = config.Normalize(c.App.Args).(map[string]interface{})
+	if parent == "" {
+		rel.Overrides, _ = config.Normalize(overrides).(map[string]interface{})
+		rel.Explicit = true
+	}
+	rel.Dependencies = dependencies(c)
+	rel.Status = release.StatusDeployed
+	if installErr != nil {
+		rel.Status = release.StatusFailed
+	}
+	rel.Registry, rel.RecipeCommit, err = registry.RecipeSource(appConfigPath)
+	if err != nil {
+		r.log.Debugf("Failed to find registry of the recipe for %s. %s", appName, err.Error())
+	}
+	if err := r.releases.Save(ctx, rel); err != nil {
+		r.log.Warnf("Failed to record release for %s. %s", appName, err.Error())
+	}
+}
+
+// deleteRelease removes the release record of the uninstalled app
+func (r *AppRunner) deleteRelease(appName, namespace string) {
+	if r.releases == nil {
+		return
+	}
+	if err := r.releases.Delete(context.Background(), appName, namespace); err != nil {
+		r.log.Warnf("Failed to delete release record for %s. %s", appName, err.Error())
+	}
+}
+
+// requiredBy returns the installed apps which still need the app, apps being removed by the run are not counted.
+// An app installed explicitly by the user is required irrespective of the other apps. Nothing is required on cascade removal.
+func (r *AppRunner) requiredBy(appName, namespace string) []string {
+	if r.releases == nil || r.opts.Cascade {
+		return nil
+	}
+	ctx := context.Background()
+	users := []string{}
+	// Explicit installation is ignored when the user removes the app itself
+	rel, err := r.releases.Get(ctx, appName, namespace)
+	if err == nil && rel.Explicit && len(r.removing) > 0 {
+		users = append(users, "user (installed explicitly)")
+	}
+	dependents, err := r.releases.Dependents(ctx, appName)
+	if err != nil {
+		r.log.Warnf("Failed to find apps depending on %s. %s", appName, err.Error())
+		return users
+	}
+	for _, d := range dependents {
+		if d.Name == appName || r.isRemoving(d.Name) {
+			continue
+		}
+		users = append(users, d.Name)
+	}
+	return users
+}
+
+// isRemoving checks if the app is being uninstalled by the run
+func (r *AppRunner) isRemoving(appName string) bool {
+	for _, a := range r.removing {
+		if a == appName {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies returns names of the pre-install and post-install apps of the recipe
+func dependencies(c *config.AppConfig) []string {
+	deps := []string{}
+	for _, phase := range c.App.PreInstall {
+		deps = append(deps, phase.Apps...)
+	}
+	for _, phase := range c.App.PostInstall {
+		deps = append(deps, phase.Apps...)
+	}
+	return deps
+}
+
 func (r *AppRunner) execCommand(ctx context.Context, cmd string) (string, error) {
 	c := exec.CommandContext(ctx, "sh", "-c", cmd)
 	c.Stderr = os.Stderr
@@ -0,0 +1,395 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/log"
+	"github.com/kbrew-dev/kbrew/pkg/release"
+)
+
+func TestUninstallPlanKeepsRequiredDeps(t *testing.T) {
+	dir := writeRecipes(t, map[string][2][]string{
+		"kafka":        {{"cert-manager", "zookeeper"}, nil},
+		"cert-manager": {nil, nil},
+		"zookeeper":    {nil, nil},
+	})
+	defer os.RemoveAll(dir)
+
+	releases := release.NewStore(fake.NewSimpleClientset())
+	for _, rel := range []*release.Release{
+		{Name: "kafka", Explicit: true, Dependencies: []string{"cert-manager", "zookeeper"}},
+		{Name: "vault", Explicit: true, Dependencies: []string{"cert-manager"}},
+		{Name: "cert-manager"},
+		{Name: "zookeeper"},
+	} {
+		if err := releases.Save(context.Background(), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "ref counted",
+			want: "uninstall:kafka,keep:cert-manager,uninstall:zookeeper",
+		},
+		{
+			name: "cascade",
+			opts: Options{Cascade: true},
+			want: "uninstall:kafka,uninstall:cert-manager,uninstall:zookeeper",
+		},
+		{
+			name: "keep deps",
+			opts: Options{KeepDeps: true},
+			want: "uninstall:kafka",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := NewAppRunner(Uninstall, log.NewLogger(false), nil, releases, tc.opts).Plan("kafka", "", filepath.Join(dir, "kafka.yaml"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for _, a := range plan {
+				if len(a.RequiredBy) > 0 {
+					got = append(got, "keep:"+a.App)
+					continue
+				}
+				got = append(got, string(a.Method)+":"+a.App)
+			}
+			if strings.Join(got, ",") != tc.want {
+				t.Errorf("unexpected plan %s, want %s", strings.Join(got, ","), tc.want)
+			}
+		})
+	}
+}
+
+func TestCascadeUninstall(t *testing.T) {
+	dir := writeRecipes(t, map[string][2][]string{
+		"kafka":        {{"cert-manager", "zookeeper"}, nil},
+		"cert-manager": {nil, nil},
+		"zookeeper":    {nil, nil},
+	})
+	defer os.RemoveAll(dir)
+
+	releases := release.NewStore(fake.NewSimpleClientset())
+	for _, rel := range []*release.Release{
+		{Name: "kafka", Namespace: "default", Explicit: true, Dependencies: []string{"cert-manager", "zookeeper"}},
+		{Name: "vault", Namespace: "default", Explicit: true, Dependencies: []string{"cert-manager"}},
+		{Name: "cert-manager", Namespace: "default"},
+		{Name: "zookeeper", Namespace: "default"},
+	} {
+		if err := releases.Save(context.Background(), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cluster := &fakeCluster{}
+	r := newFakeRunner(Uninstall, cluster, releases, Options{Cascade: true})
+	if err := r.Run(context.Background(), "kafka", "default", filepath.Join(dir, "kafka.yaml")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"kafka", "cert-manager", "zookeeper"}, cluster.uninstalls); diff != "" {
+		t.Errorf("uninstalls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := (Options{KeepDeps: true, Cascade: true}).Validate(); err == nil {
+		t.Error("expected error for keep deps with cascade")
+	}
+	for _, opts := range []Options{{}, {KeepDeps: true}, {Cascade: true}} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", opts, err)
+		}
+	}
+}
+
+func TestDependencyPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(configDir string) { config.ConfigDir = configDir }(config.ConfigDir)
+	config.ConfigDir = dir
+
+	// cert-manager is shipped by both registries, prometheus only by the upstream one
+	for _, recipe := range []string{
+		"registries/acme/recipes/recipes/stack.yaml",
+		"registries/acme/recipes/recipes/cert-manager.yaml",
+		"registries/kbrew-dev/kbrew-registry/recipes/cert-manager.yaml",
+		"registries/kbrew-dev/kbrew-registry/recipes/prometheus.yaml",
+	} {
+		path := filepath.Join(dir, recipe)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("apiVersion: v1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stack := filepath.Join(dir, "registries/acme/recipes/recipes/stack.yaml")
+	for app, want := range map[string]string{
+		"cert-manager": "registries/acme/recipes/recipes/cert-manager.yaml",
+		"prometheus":   "registries/kbrew-dev/kbrew-registry/recipes/prometheus.yaml",
+		"missing":      "registries/acme/recipes/recipes/missing.yaml",
+	} {
+		if got := dependencyPath(stack, app); got != filepath.Join(dir, want) {
+			t.Errorf("unexpected recipe path for %s: %s", app, got)
+		}
+	}
+}
+
+// fakeCluster records the operations performed by the fake apps
+type fakeCluster struct {
+	mu sync.Mutex
+	// existing holds the apps present before the run
+	existing map[string]bool
+	// failing holds the apps failing to install
+	failing    map[string]bool
+	delay      time.Duration
+	installs   []string
+	upgrades   []string
+	uninstalls []string
+	running    int
+	maxRunning int
+}
+
+// fakeApp is the App operating on the fake cluster
+type fakeApp struct {
+	cluster *fakeCluster
+}
+
+func (a *fakeApp) Install(ctx context.Context, name, namespace, version string, opt map[string]string) error {
+	return a.cluster.apply(&a.cluster.installs, name)
+}
+
+func (a *fakeApp) Upgrade(ctx context.Context, name, namespace, version string, opt map[string]string) error {
+	return a.cluster.apply(&a.cluster.upgrades, name)
+}
+
+func (a *fakeApp) Uninstall(ctx context.Context, name, namespace string) error {
+	a.cluster.mu.Lock()
+	defer a.cluster.mu.Unlock()
+	a.cluster.uninstalls = append(a.cluster.uninstalls, name)
+	return nil
+}
+
+func (a *fakeApp) Search(ctx context.Context, name string) (string, error) {
+	return name, nil
+}
+
+func (a *fakeApp) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
+	return nil, nil
+}
+
+func (a *fakeApp) Exists(ctx context.Context, name, namespace string) (bool, error) {
+	a.cluster.mu.Lock()
+	defer a.cluster.mu.Unlock()
+	return a.cluster.existing[name], nil
+}
+
+// apply records the app in ops and tracks the number of apps applied concurrently
+func (c *fakeCluster) apply(ops *[]string, name string) error {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.maxRunning {
+		c.maxRunning = c.running
+	}
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	*ops = append(*ops, name)
+	if c.failing[name] {
+		return fmt.Errorf("failed to install %s", name)
+	}
+	return nil
+}
+
+// newFakeRunner returns AppRunner operating on the fake cluster instead of the K8s cluster
+func newFakeRunner(op Method, cluster *fakeCluster, releases *release.Store, opts Options) *AppRunner {
+	logger := log.NewLogger(false)
+	logger.SetWriter(ioutil.Discard)
+	r := NewAppRunner(op, logger, log.NewProgress(logger), releases, opts)
+	r.newApp = func(c config.App, log *log.Logger) (App, error) {
+		return &fakeApp{cluster: cluster}, nil
+	}
+	return r
+}
+
+// writeRecipe writes the raw app recipe with the given app spec to the dir
+func writeRecipe(t *testing.T, dir, name, spec string) {
+	recipe := fmt.Sprintf(`apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/%s.yaml
+    type: raw
+%s`, name, spec)
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".yaml"), []byte(recipe), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRecipe(t, dir, "stack", `  pre_install:
+  - apps: [db]
+  post_install:
+  - apps: [dashboards]
+`)
+	writeRecipe(t, dir, "db", "")
+	writeRecipe(t, dir, "dashboards", "")
+
+	cluster := &fakeCluster{}
+	releases := release.NewStore(fake.NewSimpleClientset())
+	r := newFakeRunner(Upgrade, cluster, releases, Options{})
+	if err := r.Run(context.Background(), "stack", "default", filepath.Join(dir, "stack.yaml")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"db", "stack", "dashboards"}, cluster.upgrades); diff != "" {
+		t.Errorf("upgrades mismatch (-want +got):\n%s", diff)
+	}
+	if len(cluster.installs) != 0 {
+		t.Errorf("expected no installs on upgrade, got %v", cluster.installs)
+	}
+	for _, name := range []string{"db", "stack", "dashboards"} {
+		rel, err := releases.Get(context.Background(), name, "default")
+		if err != nil {
+			t.Fatalf("release of %s not recorded: %v", name, err)
+		}
+		if rel.Status != release.StatusDeployed || rel.Explicit != (name == "stack") {
+			t.Errorf("unexpected release of %s: %+v", name, rel)
+		}
+	}
+}
+
+func TestUpgradePlanReusesOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRecipe(t, dir, "db", `  args:
+    Deployment.db.spec.replicas: 1
+    Deployment.db.spec.template.spec.containers[0].image: db:v1
+`)
+
+	releases := release.NewStore(fake.NewSimpleClientset())
+	rel := &release.Release{Name: "db", Namespace: "default", Explicit: true, Overrides: map[string]interface{}{"Deployment.db.spec.replicas": 3, "Deployment.db.spec.template.spec.containers[0].image": "db:v2"}}
+	if err := releases.Save(context.Background(), rel); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Overrides: map[string]interface{}{"Deployment.db.spec.template.spec.containers[0].image": "db:v3"}}
+	plan, err := NewAppRunner(Upgrade, log.NewLogger(false), nil, releases, opts).Plan("db", "default", filepath.Join(dir, "db.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan) != 1 {
+		t.Fatalf("expected one action, got %d", len(plan))
+	}
+	got := map[string]string{}
+	for k, v := range plan[0].Args {
+		got[k] = fmt.Sprint(v)
+	}
+	if diff := cmp.Diff(map[string]string{
+		"Deployment.db.spec.replicas":                          "3",
+		"Deployment.db.spec.template.spec.containers[0].image": "db:v3",
+	}, got); diff != "" {
+		t.Errorf("args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParallelInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRecipe(t, dir, "stack", `  pre_install:
+  - apps: [web, api, worker]
+`)
+	writeRecipe(t, dir, "web", `  pre_install:
+  - apps: [db]
+`)
+	writeRecipe(t, dir, "api", `  pre_install:
+  - apps: [db]
+`)
+	writeRecipe(t, dir, "worker", "")
+	writeRecipe(t, dir, "db", "")
+
+	t.Run("shared dependency", func(t *testing.T) {
+		cluster := &fakeCluster{delay: 20 * time.Millisecond}
+		r := newFakeRunner(Install, cluster, release.NewStore(fake.NewSimpleClientset()), Options{Parallelism: 2})
+		if err := r.Run(context.Background(), "stack", "default", filepath.Join(dir, "stack.yaml")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		count := map[string]int{}
+		for _, name := range cluster.installs {
+			count[name]++
+		}
+		if diff := cmp.Diff(map[string]int{"db": 1, "web": 1, "api": 1, "worker": 1, "stack": 1}, count); diff != "" {
+			t.Errorf("installs mismatch (-want +got):\n%s", diff)
+		}
+		if cluster.installs[len(cluster.installs)-1] != "stack" {
+			t.Errorf("expected stack to be installed after its dependencies, got %v", cluster.installs)
+		}
+		if cluster.maxRunning != 2 {
+			t.Errorf("expected 2 apps installed concurrently, got %d", cluster.maxRunning)
+		}
+	})
+
+	t.Run("first error", func(t *testing.T) {
+		cluster := &fakeCluster{delay: 20 * time.Millisecond, failing: map[string]bool{"api": true}}
+		r := newFakeRunner(Install, cluster, release.NewStore(fake.NewSimpleClientset()), Options{Parallelism: 2})
+		err := r.Run(context.Background(), "stack", "default", filepath.Join(dir, "stack.yaml"))
+		if err == nil || !strings.Contains(err.Error(), "failed to install api") {
+			t.Fatalf("expected api install error, got %v", err)
+		}
+		for _, name := range cluster.installs {
+			if name == "stack" {
+				t.Errorf("expected stack not to be installed after a dependency failed, got %v", cluster.installs)
+			}
+		}
+		if cluster.maxRunning > 2 {
+			t.Errorf("expected at most 2 apps installed concurrently, got %d", cluster.maxRunning)
+		}
+	})
+}
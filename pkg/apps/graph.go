@@ -0,0 +1,137 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+// ErrDependencyCycle is returned when the recipes depend on each other in a cycle
+var ErrDependencyCycle = errors.New("dependency cycle detected")
+
+// Node is an app in the dependency graph
+type Node struct {
+	Name       string
+	RecipePath string
+	// PreInstall apps are installed before the app
+	PreInstall []*Node
+	// PostInstall apps are installed after the app
+	PostInstall []*Node
+}
+
+// Graph is the dependency graph of an app. Apps shared by multiple recipes are represented by a single node.
+type Graph struct {
+	Root  *Node
+	nodes map[string]*Node
+}
+
+// BuildGraph loads the recipe of the app and all its dependency recipes and returns the dependency graph.
+// ErrDependencyCycle is returned if the recipes depend on each other in a cycle.
+func BuildGraph(appName, appConfigPath string) (*Graph, error) {
+	g := &Graph{nodes: map[string]*Node{}}
+	root, err := g.add(appName, appConfigPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	g.Root = root
+	return g, nil
+}
+
+// Len returns the number of unique apps in the graph
+func (g *Graph) Len() int {
+	return len(g.nodes)
+}
+
+// add adds the app and its dependencies to the graph, path is the chain of apps depending on the app
+func (g *Graph) add(appName, appConfigPath string, path []string) (*Node, error) {
+	for i, p := range path {
+		if p == appName {
+			cycle := append(append([]string{}, path[i:]...), appName)
+			return nil, errors.Wrap(ErrDependencyCycle, strings.Join(cycle, " -> "))
+		}
+	}
+	// Apps added before are either in the path, or all their dependencies are added and none of them is in the path
+	if n, ok := g.nodes[appConfigPath]; ok {
+		return n, nil
+	}
+
+	c, err := config.NewApp(appName, appConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{Name: appName, RecipePath: appConfigPath}
+	g.nodes[appConfigPath] = n
+	path = append(path, appName)
+	for _, phase := range c.App.PreInstall {
+		for _, a := range phase.Apps {
+			dep, err := g.add(a, dependencyPath(appConfigPath, a), path)
+			if err != nil {
+				return nil, err
+			}
+			n.PreInstall = append(n.PreInstall, dep)
+		}
+	}
+	for _, phase := range c.App.PostInstall {
+		for _, a := range phase.Apps {
+			dep, err := g.add(a, dependencyPath(appConfigPath, a), path)
+			if err != nil {
+				return nil, err
+			}
+			n.PostInstall = append(n.PostInstall, dep)
+		}
+	}
+	return n, nil
+}
+
+// String returns the dependency tree of the app. Subtrees of apps shared by multiple recipes are printed once.
+func (g *Graph) String() string {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, g.Root.Name)
+	printTree(&b, g.Root, "", map[*Node]bool{g.Root: true})
+	return b.String()
+}
+
+func printTree(b *bytes.Buffer, n *Node, indent string, printed map[*Node]bool) {
+	type child struct {
+		node  *Node
+		phase Phase
+	}
+	children := []child{}
+	for _, dep := range n.PreInstall {
+		children = append(children, child{dep, PreInstallPhase})
+	}
+	for _, dep := range n.PostInstall {
+		children = append(children, child{dep, PostInstallPhase})
+	}
+	for i, c := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+		if printed[c.node] {
+			fmt.Fprintf(b, "%s%s%s (%s, see above)\n", indent, branch, c.node.Name, c.phase)
+			continue
+		}
+		printed[c.node] = true
+		fmt.Fprintf(b, "%s%s%s (%s)\n", indent, branch, c.node.Name, c.phase)
+		printTree(b, c.node, indent+next, printed)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// writeRecipes writes raw app recipes to a temp dir, deps maps the app name to its pre and post install apps
+func writeRecipes(t *testing.T, deps map[string][2][]string) string {
+	dir, err := ioutil.TempDir("", "kbrew-graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, d := range deps {
+		recipe := fmt.Sprintf(`apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/%s.yaml
+    type: raw
+  pre_install:
+  - apps: [%s]
+  post_install:
+  - apps: [%s]
+`, name, strings.Join(d[0], ", "), strings.Join(d[1], ", "))
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".yaml"), []byte(recipe), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildGraph(t *testing.T) {
+	dir := writeRecipes(t, map[string][2][]string{
+		"stack":               {{"cert-manager", "prometheus-operator"}, {"dashboards"}},
+		"prometheus-operator": {{"cert-manager"}, nil},
+		"dashboards":          {{"prometheus-operator"}, nil},
+		"cert-manager":        {nil, nil},
+	})
+	defer os.RemoveAll(dir)
+
+	g, err := BuildGraph("stack", filepath.Join(dir, "stack.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g.Len() != 4 {
+		t.Errorf("expected 4 apps in the graph, got %d", g.Len())
+	}
+	want := `stack
+├── cert-manager (pre-install)
+├── prometheus-operator (pre-install)
+│   └── cert-manager (pre-install, see above)
+└── dashboards (post-install)
+    └── prometheus-operator (pre-install, see above)
+`
+	if got := g.String(); got != want {
+		t.Errorf("unexpected tree, got:\n%s\nwant:\n%s", got, want)
+	}
+
+	plan, err := NewAppRunner(Install, nil, nil, nil, Options{}).Plan("stack", "", filepath.Join(dir, "stack.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := []string{}
+	for _, a := range plan {
+		order = append(order, a.App)
+	}
+	if got := strings.Join(order, ","); got != "cert-manager,prometheus-operator,stack,dashboards" {
+		t.Errorf("unexpected install order %s", got)
+	}
+}
+
+func TestBuildGraphCycle(t *testing.T) {
+	dir := writeRecipes(t, map[string][2][]string{
+		"a": {{"b"}, nil},
+		"b": {nil, {"c"}},
+		"c": {{"a"}, nil},
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := BuildGraph("a", filepath.Join(dir, "a.yaml"))
+	if !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("expected dependency cycle error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected cycle path in error, got %v", err)
+	}
+}
@@ -15,74 +15,253 @@
 package helm
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	helmkube "helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/kbrew-dev/kbrew/pkg/apps/raw"
 	"github.com/kbrew-dev/kbrew/pkg/config"
 	"github.com/kbrew-dev/kbrew/pkg/log"
+	"github.com/kbrew-dev/kbrew/pkg/util"
 )
 
-type method string
+// defaultTimeout is used for helm operations if the context has no deadline
+const defaultTimeout = 15 * time.Minute
 
-const (
-	installMethod   method = "install"
-	statusMethod    method = "status"
-	uninstallMethod method = "delete"
-	// getManifestMethod method = "get manifest" // unused
+var (
+	// ErrReleaseNotFound is returned when the helm release of the app does not exist
+	ErrReleaseNotFound = driver.ErrReleaseNotFound
+	// ErrChartNotFound is returned when the chart is not found in the helm repo
+	ErrChartNotFound = errors.New("chart not found in helm repo")
+
+	// repoMu guards the helm repositories config and the repo cache shared by the apps installed in parallel
+	repoMu sync.Mutex
 )
 
 // App holds helm app details
 type App struct {
-	app config.App
-	log *log.Logger
+	app      config.App
+	log      *log.Logger
+	settings *cli.EnvSettings
+	// cfg is the helm action configuration used instead of the one built from the kube config if set
+	cfg *action.Configuration
 }
 
 // New returns Helm App
 func New(c config.App, log *log.Logger) *App {
 	return &App{
-		app: c,
-		log: log,
+		app:      c,
+		log:      log,
+		settings: cli.New(),
 	}
 }
 
 // Install installs the application specified by name, version and namespace.
 func (ha *App) Install(ctx context.Context, name, namespace, version string, options map[string]string) error {
-	//TODO: Resolve Deps
-	// Validate and install chart
-	// TODO(@prasad): Use go sdks
-	// Needs helm3
-	if _, err := ha.addRepo(ctx); err != nil {
+	if err := ha.resolveArgs(); err != nil {
 		return err
 	}
-	if err := ha.resolveArgs(); err != nil {
+	cfg, err := ha.actionConfig(namespace)
+	if err != nil {
 		return err
 	}
-	_, err := helmCommand(ctx, statusMethod, name, "", namespace, "", nil)
-	if err == nil {
+	exists, err := releaseExists(cfg, name)
+	if err != nil {
+		return err
+	}
+	if exists {
 		// helm release already exists, return from here
 		ha.log.Warnf("helm app %s/%s already exists in %s namespace. Skipping...\n", ha.app.Repository.Name, name, namespace)
 		return nil
 	}
+	return ha.install(ctx, cfg, name, namespace, version)
+}
 
-	out, err := helmCommand(ctx, installMethod, name, version, namespace, fmt.Sprintf("%s/%s", ha.app.Repository.Name, name), ha.app.Args)
-	ha.log.Debug(out)
-	return err
+// Upgrade upgrades the application specified by name and namespace to the given version.
+// The application gets installed if the release does not exist.
+func (ha *App) Upgrade(ctx context.Context, name, namespace, version string, options map[string]string) error {
+	if err := ha.resolveArgs(); err != nil {
+		return err
+	}
+	cfg, err := ha.actionConfig(namespace)
+	if err != nil {
+		return err
+	}
+	exists, err := releaseExists(cfg, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ha.install(ctx, cfg, name, namespace, version)
+	}
+
+	chrt, err := ha.loadChart(name, version)
+	if err != nil {
+		return err
+	}
+	vals, err := chartValues(ha.app)
+	if err != nil {
+		return err
+	}
+	client := action.NewUpgrade(cfg)
+	client.Namespace = namespace
+	client.Version = version
+	client.Wait = true
+	client.Timeout = timeout(ctx)
+	return runWithContext(ctx, client.Timeout, func() error {
+		_, err := client.Run(name, chrt, vals)
+		return errors.Wrapf(err, "Failed to upgrade helm release %s", name)
+	})
 }
 
 // Uninstall uninstalls the application specified by name and namespace.
 func (ha *App) Uninstall(ctx context.Context, name, namespace string) error {
-	//TODO: Resolve Deps
-	// Validate and install chart
-	// TODO(@prasad): Use go sdks
-	out, err := helmCommand(ctx, uninstallMethod, name, "", namespace, "", nil)
-	ha.log.Debug(out)
-	return err
+	cfg, err := ha.actionConfig(namespace)
+	if err != nil {
+		return err
+	}
+	client := action.NewUninstall(cfg)
+	client.Timeout = timeout(ctx)
+	return runWithContext(ctx, client.Timeout, func() error {
+		resp, err := client.Run(name)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to uninstall helm release %s", name)
+		}
+		if resp != nil && resp.Info != "" {
+			ha.log.Debug(resp.Info)
+		}
+		return nil
+	})
+}
+
+// Search searches the name passed in helm repo or OCI registry
+func (ha *App) Search(ctx context.Context, name string) (string, error) {
+	if IsOCI(ha.app.Repository.URL) {
+		if _, err := pullOCIChart(ctx, ha.settings.RegistryConfig, ha.app.Repository.URL, name, ha.app.Version); err != nil {
+			return "", err
+		}
+		var b bytes.Buffer
+		w := tabwriter.NewWriter(&b, 0, 0, 1, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAME\tCHART REFERENCE")
+		fmt.Fprintf(w, "%s\t%s", name, ociReference(ha.app.Repository.URL, name, ha.app.Version))
+		w.Flush()
+		return b.String(), nil
+	}
+	if IsLocal(ha.app.Repository.URL) {
+		chrt, err := ha.loadChart(name, ha.app.Version)
+		if err != nil {
+			return "", err
+		}
+		var b bytes.Buffer
+		w := tabwriter.NewWriter(&b, 0, 0, 1, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAME\tCHART VERSION\tAPP VERSION\tDESCRIPTION")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s", name, chrt.Metadata.Version, chrt.Metadata.AppVersion, chrt.Metadata.Description)
+		w.Flush()
+		return b.String(), nil
+	}
+	index, err := ha.addRepo()
+	if err != nil {
+		return "", err
+	}
+	cv, err := index.Get(name, "")
+	if err != nil {
+		return "", errors.Wrapf(ErrChartNotFound, "%s/%s", ha.app.Repository.Name, name)
+	}
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 1, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "NAME\tCHART VERSION\tAPP VERSION\tDESCRIPTION")
+	fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s", ha.app.Repository.Name, name, cv.Version, cv.AppVersion, cv.Description)
+	w.Flush()
+	return b.String(), nil
+}
+
+// Workloads returns K8s workload object reference list for the helm app
+func (ha *App) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
+	manifest, err := ha.getManifests(namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get helm chart manifests")
+	}
+	return raw.ParseManifestYAML(manifest, namespace)
+}
+
+// Render renders the chart of the app with the recipe args locally, without cluster access
+func Render(c config.App, name, namespace string) (string, error) {
+	ha := New(c, nil)
+	chrt, err := ha.loadChart(name, c.Version)
+	if err != nil {
+		return "", err
+	}
+	vals, err := chartValues(c)
+	if err != nil {
+		return "", err
+	}
+	client := action.NewInstall(&action.Configuration{Log: ha.debugLog})
+	client.DryRun = true
+	client.ClientOnly = true
+	client.Replace = true
+	client.IncludeCRDs = true
+	client.ReleaseName = name
+	client.Namespace = namespace
+	rel, err := client.Run(chrt, vals)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to render %s chart", name)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, strings.TrimSpace(rel.Manifest))
+	for _, h := range rel.Hooks {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", h.Path, strings.TrimSpace(h.Manifest))
+	}
+	return b.String(), nil
+}
+
+// Digest returns the sha256 digest of the chart archive of the app to be set in the recipe
+func Digest(c config.App, name string) (string, error) {
+	data, err := New(c, nil).chartArchive(name, c.Version)
+	if err != nil {
+		return "", err
+	}
+	return util.SHA256(bytes.NewReader(data))
+}
+
+func (ha *App) install(ctx context.Context, cfg *action.Configuration, name, namespace, version string) error {
+	chrt, err := ha.loadChart(name, version)
+	if err != nil {
+		return err
+	}
+	vals, err := chartValues(ha.app)
+	if err != nil {
+		return err
+	}
+	client := action.NewInstall(cfg)
+	client.ReleaseName = name
+	client.Namespace = namespace
+	client.Version = version
+	client.CreateNamespace = true
+	client.Wait = true
+	client.Timeout = timeout(ctx)
+	return runWithContext(ctx, client.Timeout, func() error {
+		_, err := client.Run(chrt, vals)
+		return errors.Wrapf(err, "Failed to install helm release %s", name)
+	})
 }
 
 func (ha *App) resolveArgs() error {
@@ -96,82 +275,191 @@ func (ha *App) resolveArgs() error {
 	return nil
 }
 
-func (ha *App) addRepo(ctx context.Context) (string, error) {
-	// Needs helm 3.2+
-	c := exec.CommandContext(ctx, "helm", "repo", "add", ha.app.Repository.Name, ha.app.Repository.URL)
-	if out, err := c.CombinedOutput(); err != nil {
-		return string(out), err
+// actionConfig returns helm action configuration to operate on the releases in the namespace
+func (ha *App) actionConfig(namespace string) (*action.Configuration, error) {
+	if ha.cfg != nil {
+		return ha.cfg, nil
 	}
-	return ha.updateRepo(ctx)
+	cfg := &action.Configuration{}
+	getter := helmkube.GetConfig(ha.settings.KubeConfig, ha.settings.KubeContext, namespace)
+	if err := cfg.Init(getter, namespace, os.Getenv("HELM_DRIVER"), ha.debugLog); err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize helm client")
+	}
+	return cfg, nil
 }
 
-func (ha *App) updateRepo(ctx context.Context) (string, error) {
-	// Needs helm 3.2+
-	c := exec.CommandContext(ctx, "helm", "repo", "update")
-	out, err := c.CombinedOutput()
-	return string(out), err
-}
+// addRepo adds the app repo to the helm repositories config and fetches the latest repo index
+func (ha *App) addRepo() (*repo.IndexFile, error) {
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	entry := &repo.Entry{
+		Name: ha.app.Repository.Name,
+		URL:  ha.app.Repository.URL,
+	}
+	chartRepo, err := repo.NewChartRepository(entry, getter.All(ha.settings))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to add helm repo %s", entry.Name)
+	}
+	chartRepo.CachePath = ha.settings.RepositoryCache
+	indexPath, err := chartRepo.DownloadIndexFile()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to fetch index of helm repo %s", entry.Name)
+	}
 
-func (ha *App) getManifests(ctx context.Context, namespace string) (string, error) {
-	c := exec.CommandContext(ctx, "helm", "get", "manifest", ha.app.Name, "--namespace", namespace)
-	out, err := c.CombinedOutput()
-	return string(out), err
+	repoFile, err := repo.LoadFile(ha.settings.RepositoryConfig)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.Wrap(err, "Failed to load helm repositories config")
+	}
+	if repoFile == nil || os.IsNotExist(errors.Cause(err)) {
+		repoFile = repo.NewFile()
+	}
+	repoFile.Update(entry)
+	if err := os.MkdirAll(filepath.Dir(ha.settings.RepositoryConfig), os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "Failed to create helm config dir")
+	}
+	if err := repoFile.WriteFile(ha.settings.RepositoryConfig, 0644); err != nil {
+		return nil, errors.Wrap(err, "Failed to write helm repositories config")
+	}
+
+	index, err := repo.LoadIndexFile(indexPath)
+	return index, errors.Wrapf(err, "Failed to load index of helm repo %s", entry.Name)
 }
 
-// Search searches the name passed in helm repo
-func (ha *App) Search(ctx context.Context, name string) (string, error) {
-	// Needs helm 3.2+
-	if out, err := ha.addRepo(ctx); err != nil {
-		return out, err
+// loadChart downloads the chart from the app repo and loads it.
+// The chart archive is verified against the sha256 digest set in the recipe.
+func (ha *App) loadChart(name, version string) (*chart.Chart, error) {
+	if IsLocal(ha.app.Repository.URL) {
+		chartPath, err := localChartPath(ha.app, name)
+		if err != nil {
+			return nil, err
+		}
+		// Chart directories are loaded as is, digest can only be verified for archives
+		if fi, err := os.Stat(chartPath); err == nil && fi.IsDir() {
+			if ha.app.SHA256 != "" {
+				return nil, errors.Errorf("sha256 digest can not be verified for chart directory %s, use a chart archive", chartPath)
+			}
+			chrt, err := loader.LoadDir(chartPath)
+			return chrt, errors.Wrapf(err, "Failed to load chart %s", chartPath)
+		}
 	}
-	c := exec.CommandContext(ctx, "helm", "search", "repo", fmt.Sprintf("%s/%s", ha.app.Repository.Name, name))
-	out, err := c.CombinedOutput()
+	data, err := ha.chartArchive(name, version)
 	if err != nil {
-		return string(out), err
+		return nil, err
 	}
-	if strings.Contains(string(out), "No results found") {
-		return string(out), errors.New("No results found")
+	if err := util.VerifySHA256(data, ha.app.SHA256); err != nil {
+		return nil, errors.Wrapf(err, "Failed to verify chart %s", name)
 	}
-	return string(out), err
+	chrt, err := loader.LoadArchive(bytes.NewReader(data))
+	return chrt, errors.Wrapf(err, "Failed to load chart %s", name)
 }
 
-// Workloads returns K8s workload object reference list for the helm app
-func (ha *App) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
-	manifest, err := ha.getManifests(ctx, namespace)
+// chartArchive returns the chart archive of the app, downloaded from the helm repo or the OCI registry or read from the local path
+func (ha *App) chartArchive(name, version string) ([]byte, error) {
+	var chartPath string
+	var err error
+	switch {
+	case IsOCI(ha.app.Repository.URL):
+		return pullOCIChart(context.Background(), ha.settings.RegistryConfig, ha.app.Repository.URL, name, version)
+	case IsLocal(ha.app.Repository.URL):
+		chartPath, err = localChartPath(ha.app, name)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(chartPath); err == nil && fi.IsDir() {
+			return nil, errors.Errorf("%s is a chart directory, not an archive", chartPath)
+		}
+	default:
+		chartPath, err = ha.locateChart(name, version)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := ioutil.ReadFile(chartPath)
+	return data, errors.Wrapf(err, "Failed to read chart %s", chartPath)
+}
+
+// locateChart downloads the chart archive from the app repo and returns its path
+func (ha *App) locateChart(name, version string) (string, error) {
+	if _, err := ha.addRepo(); err != nil {
+		return "", err
+	}
+	cpo := action.ChartPathOptions{Version: version}
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	chartPath, err := cpo.LocateChart(fmt.Sprintf("%s/%s", ha.app.Repository.Name, name), ha.settings)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to get helm chart manifests")
+		return "", errors.Wrapf(ErrChartNotFound, "%s/%s: %s", ha.app.Repository.Name, name, err.Error())
 	}
-	return raw.ParseManifestYAML(manifest, namespace)
+	return chartPath, nil
 }
 
-func helmCommand(ctx context.Context, m method, name, version, namespace, chart string, chartArgs map[string]interface{}) (string, error) {
-	// Needs helm 3.2+
-	c := exec.CommandContext(ctx, "helm", string(m), name, "--namespace", namespace)
-	if chart != "" {
-		c.Args = append(c.Args, chart)
+func (ha *App) getManifests(namespace string) (string, error) {
+	cfg, err := ha.actionConfig(namespace)
+	if err != nil {
+		return "", err
 	}
-	if version != "" {
-		c.Args = append(c.Args, "--version", version)
+	rel, err := action.NewGet(cfg).Run(ha.app.Name)
+	if err != nil {
+		return "", err
+	}
+	return rel.Manifest, nil
+}
+
+func (ha *App) debugLog(format string, v ...interface{}) {
+	if ha.log != nil {
+		ha.log.Debugf(format, v...)
 	}
-	if m == installMethod {
-		// Add extra time to wait arg so that context will be timeout out before helm command failure
-		// This is for catching timeout through context instead of parsing helm command output
-		// This might change once we switch to SDKs
-		c.Args = append(c.Args, "--wait", "--timeout", "5h0m", "--create-namespace")
+}
+
+// Exists checks if the helm release of the app exists in the namespace
+func (ha *App) Exists(ctx context.Context, name, namespace string) (bool, error) {
+	cfg, err := ha.actionConfig(namespace)
+	if err != nil {
+		return false, err
 	}
+	return releaseExists(cfg, name)
+}
 
-	if len(chartArgs) != 0 {
-		c.Args = append(c.Args, appendChartArgs(chartArgs)...)
+// releaseExists checks if any revision of the release exists
+func releaseExists(cfg *action.Configuration, name string) (bool, error) {
+	_, err := cfg.Releases.History(name)
+	if err == nil {
+		return true, nil
 	}
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return false, nil
+	}
+	return false, errors.Wrapf(err, "Failed to get status of helm release %s", name)
+}
 
-	out, err := c.CombinedOutput()
-	return string(out), err
+// timeout returns time left till the context deadline
+func timeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeout
+	}
+	return time.Until(deadline)
 }
 
-func appendChartArgs(args map[string]interface{}) []string {
-	var s []string
-	for k, v := range args {
-		s = append(s, "--set", k+"="+fmt.Sprintf("%s", v))
+// runWithContext runs the helm operation and returns the context error if the context is done.
+// helm actions do not accept context, they are bound by the timeout derived from the context instead.
+// On cancellation it waits for the operation to return, at most for the timeout, so that the caller
+// does not act on the release, e.g. roll it back, while the operation is still applying it.
+func runWithContext(ctx context.Context, timeout time.Duration, f func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-errCh:
+	case <-t.C:
 	}
-	return s
+	return ctx.Err()
 }
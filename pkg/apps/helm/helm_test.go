@@ -0,0 +1,112 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/log"
+)
+
+func TestRunWithContextWaitsForOperation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := false
+	err := runWithContext(ctx, time.Minute, func() error {
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+		done = true
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context canceled error, got %v", err)
+	}
+	if !done {
+		t.Error("expected the operation to finish before returning")
+	}
+
+	// Operation outliving the timeout is not waited for
+	ctx, cancel = context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	err = runWithContext(ctx, 100*time.Millisecond, func() error {
+		cancel()
+		<-release
+		return nil
+	})
+	if err != context.Canceled || time.Since(start) > 10*time.Second {
+		t.Errorf("expected context canceled error after the timeout, got %v in %s", err, time.Since(start))
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-helm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chrt := &chart.Chart{
+		Metadata:  &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "hello", Version: "0.1.0"},
+		Values:    map[string]interface{}{"greeting": "hi"},
+		Templates: []*chart.File{{Name: "templates/configmap.yaml", Data: []byte(configMapTemplate)}},
+	}
+	if err := chartutil.SaveDir(chrt, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Releases are stored in memory and the objects are not applied to any cluster
+	cfg := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(string, ...interface{}) {},
+	}
+	ctx := context.Background()
+	for i, greeting := range []string{"hello", "bye"} {
+		ha := New(config.App{
+			Repository: config.Repository{URL: filepath.Join(dir, "hello"), Type: config.Helm},
+			Args:       map[string]interface{}{"greeting": greeting},
+		}, log.NewLogger(false))
+		ha.cfg = cfg
+		// Upgrade installs the release if it does not exist
+		if err := ha.Upgrade(ctx, "hello", "default", "", nil); err != nil {
+			t.Fatalf("failed to upgrade release: %v", err)
+		}
+		rel, err := cfg.Releases.Last("hello")
+		if err != nil {
+			t.Fatalf("failed to get release: %v", err)
+		}
+		if rel.Version != i+1 || !strings.Contains(rel.Manifest, "greeting: "+greeting) {
+			t.Errorf("unexpected release revision %d with manifest:\n%s", rel.Version, rel.Manifest)
+		}
+		if exists, err := ha.Exists(ctx, "hello", "default"); err != nil || !exists {
+			t.Errorf("expected release to exist, got %v, %v", exists, err)
+		}
+	}
+}
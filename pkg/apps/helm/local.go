@@ -0,0 +1,57 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const fileScheme = "file://"
+
+// IsLocal returns true if the repository URL refers to a chart directory or archive on the local filesystem
+func IsLocal(url string) bool {
+	return !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !IsOCI(url)
+}
+
+// localChartPath returns the path of the local chart of the app. Relative paths are resolved against the recipe dir.
+// The repository URL can point to a chart archive, a chart directory or a directory containing the chart dir named after the app.
+func localChartPath(c config.App, name string) (string, error) {
+	path := strings.TrimPrefix(c.Repository.URL, fileScheme)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.RecipeDir, path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrapf(ErrChartNotFound, "%s: %s", name, err.Error())
+	}
+	if !fi.IsDir() {
+		return path, nil
+	}
+	if ok, _ := chartutil.IsChartDir(path); ok {
+		return path, nil
+	}
+	chartDir := filepath.Join(path, name)
+	if ok, _ := chartutil.IsChartDir(chartDir); ok {
+		return chartDir, nil
+	}
+	return "", errors.Wrapf(ErrChartNotFound, "%s: no chart found in %s", name, path)
+}
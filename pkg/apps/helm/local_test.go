@@ -0,0 +1,84 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const configMapTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  greeting: {{ .Values.greeting }}
+`
+
+func TestRenderLocalChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-helm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chrt := &chart.Chart{
+		Metadata:  &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "hello", Version: "0.1.0"},
+		Values:    map[string]interface{}{"greeting": "hi"},
+		Templates: []*chart.File{{Name: "templates/configmap.yaml", Data: []byte(configMapTemplate)}},
+	}
+	if err := chartutil.SaveDir(chrt, filepath.Join(dir, "charts")); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := chartutil.Save(chrt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"chart dir":            "charts/hello",
+		"dir with chart dirs":  "charts",
+		"chart archive":        filepath.Base(archive),
+		"absolute archive url": "file://" + archive,
+	}
+	for name, url := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := config.App{
+				Repository: config.Repository{URL: url, Type: config.Helm},
+				Args:       map[string]interface{}{"greeting": "hello"},
+				RecipeDir:  dir,
+			}
+			manifest, err := Render(c, "hello", "default")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(manifest, "greeting: hello") {
+				t.Errorf("rendered manifest does not contain args:\n%s", manifest)
+			}
+		})
+	}
+
+	if _, err := Render(config.App{Repository: config.Repository{URL: "missing"}, RecipeDir: dir}, "hello", "default"); err == nil {
+		t.Error("expected error for missing chart, got nil")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	auth "github.com/deislabs/oras/pkg/auth/docker"
+	"github.com/deislabs/oras/pkg/content"
+	"github.com/deislabs/oras/pkg/oras"
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	ociScheme = "oci://"
+
+	// helmChartConfigMediaType is the media type of the helm chart config in OCI registries
+	helmChartConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	// helmChartContentLayerMediaType is the media type of the helm chart archive in OCI registries
+	helmChartContentLayerMediaType = "application/tar+gzip"
+)
+
+// IsOCI returns true if the repository URL refers to an OCI registry
+func IsOCI(url string) bool {
+	return strings.HasPrefix(url, ociScheme)
+}
+
+// ociReference returns the reference of the chart in the OCI registry.
+// The version is used as the tag of the chart, or as the digest if it starts with "sha256:".
+// The latest tag is used if the version is not set.
+func ociReference(url, name, version string) string {
+	ref := fmt.Sprintf("%s/%s", strings.TrimSuffix(strings.TrimPrefix(url, ociScheme), "/"), name)
+	switch {
+	case version == "":
+		return ref + ":latest"
+	case strings.HasPrefix(version, "sha256:"):
+		return ref + "@" + version
+	default:
+		return ref + ":" + version
+	}
+}
+
+// pullOCIChart pulls the chart archive from the OCI registry.
+// Registry credentials are read from the docker config and the helm registry config.
+func pullOCIChart(ctx context.Context, registryConfig, url, name, version string) ([]byte, error) {
+	ref := ociReference(url, name, version)
+	authClient, err := auth.NewClient(
+		filepath.Join(dockerconfig.Dir(), dockerconfig.ConfigFileName),
+		registryConfig,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load OCI registry credentials")
+	}
+	resolver, err := authClient.Resolver(ctx, http.DefaultClient, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create OCI registry resolver")
+	}
+
+	store := content.NewMemoryStore()
+	_, layers, err := oras.Pull(ctx, resolver, ref, store,
+		oras.WithPullEmptyNameAllowed(),
+		oras.WithAllowedMediaTypes([]string{helmChartConfigMediaType, helmChartContentLayerMediaType}))
+	if err != nil {
+		return nil, errors.Wrapf(ErrChartNotFound, "%s: %s", ref, err.Error())
+	}
+	for _, layer := range layers {
+		if layer.MediaType != helmChartContentLayerMediaType {
+			continue
+		}
+		_, data, ok := store.Get(layer)
+		if !ok {
+			return nil, errors.Errorf("Failed to get chart archive %s of %s", layer.Digest, ref)
+		}
+		return data, nil
+	}
+	return nil, errors.Errorf("OCI artifact %s has no layer with media type %s", ref, helmChartContentLayerMediaType)
+}
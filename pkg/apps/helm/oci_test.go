@@ -0,0 +1,37 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import "testing"
+
+func TestOCIReference(t *testing.T) {
+	cases := map[string]struct {
+		url     string
+		version string
+		want    string
+	}{
+		"tag":            {url: "oci://ghcr.io/org/charts", version: "1.2.3", want: "ghcr.io/org/charts/nginx:1.2.3"},
+		"trailing slash": {url: "oci://ghcr.io/org/charts/", version: "1.2.3", want: "ghcr.io/org/charts/nginx:1.2.3"},
+		"no version":     {url: "oci://registry:5000/charts", want: "registry:5000/charts/nginx:latest"},
+		"digest":         {url: "oci://ghcr.io/charts", version: "sha256:abcd", want: "ghcr.io/charts/nginx@sha256:abcd"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := ociReference(tc.url, "nginx", tc.version); got != tc.want {
+				t.Errorf("ociReference() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/util"
+)
+
+// chartValues returns the values to install the chart with. Values are merged in the following order,
+// later ones taking precedence:
+//  1. values files listed in the recipe, in the order of the list
+//  2. structured values set in the recipe
+//  3. recipe args, set the same way as "--set" flags
+func chartValues(c config.App) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	for _, f := range c.ValuesFiles {
+		fileVals, err := readValuesFile(f, c.RecipeDir)
+		if err != nil {
+			return nil, err
+		}
+		vals = mergeMaps(vals, fileVals)
+	}
+
+	recipeVals, ok := config.Normalize(c.Values).(map[string]interface{})
+	if ok {
+		vals = mergeMaps(vals, recipeVals)
+	}
+
+	// Sort keys so that the result is deterministic if args overlap
+	keys := make([]string, 0, len(c.Args))
+	for k := range c.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := setValue(vals, k, c.Args[k]); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse arg %s", k)
+		}
+	}
+	return vals, nil
+}
+
+// setValue sets the value at the path specified by the key in "--set" format, e.g "a.b[0].c".
+// The value is set as is, without converting it to a string, so that numbers, booleans, lists and maps are preserved.
+func setValue(vals map[string]interface{}, key string, value interface{}) error {
+	if value == nil {
+		value = ""
+	}
+	value = config.Normalize(value)
+	return strvals.ParseIntoFile(fmt.Sprintf("%s=-", key), vals, func([]rune) (interface{}, error) {
+		return value, nil
+	})
+}
+
+// readValuesFile reads the values file from the URL or the path relative to the recipe dir
+func readValuesFile(location, recipeDir string) (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err = util.FetchURL(location)
+	} else {
+		if !filepath.IsAbs(location) {
+			location = filepath.Join(recipeDir, location)
+		}
+		data, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read values file %s", location)
+	}
+	vals := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &vals); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse values file %s", location)
+	}
+	return vals, nil
+}
+
+// mergeMaps deep merges the maps, values in b take precedence
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v2"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const recipe = `
+app:
+  values_files:
+  - values/base.yaml
+  - values/prod.yaml
+  values:
+    resources:
+      limits:
+        cpu: 500m
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: kafka
+  args:
+    replicaCount: 3
+    image.tag: "1.0"
+    persistence.enabled: true
+    nodeSelector:
+      disk: ssd
+    extraArgs[1]: --verbose
+`
+
+func TestChartValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"base.yaml": "replicaCount: 1\nimage:\n  repository: nginx\n  tag: latest\nresources:\n  limits:\n    memory: 1Gi\n",
+		"prod.yaml": "resources:\n  limits:\n    memory: 4Gi\n",
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "values"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "values", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &config.AppConfig{}
+	if err := yaml.Unmarshal([]byte(recipe), c); err != nil {
+		t.Fatal(err)
+	}
+	c.App.RecipeDir = dir
+
+	got, err := chartValues(c.App)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]interface{}{
+		"replicaCount": 3,
+		"image": map[string]interface{}{
+			"repository": "nginx",
+			"tag":        "1.0",
+		},
+		"resources": map[string]interface{}{
+			"limits": map[string]interface{}{
+				"cpu":    "500m",
+				"memory": "4Gi",
+			},
+		},
+		"tolerations": []interface{}{
+			map[string]interface{}{"key": "dedicated", "operator": "Equal", "value": "kafka"},
+		},
+		"persistence":  map[string]interface{}{"enabled": true},
+		"nodeSelector": map[string]interface{}{"disk": "ssd"},
+		"extraArgs":    []interface{}{nil, "--verbose"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("chartValues() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestChartValuesMissingFile(t *testing.T) {
+	c := config.App{ValuesFiles: []string{"missing.yaml"}, RecipeDir: os.TempDir()}
+	if _, err := chartValues(c); err == nil {
+		t.Error("expected error for missing values file, got nil")
+	}
+}
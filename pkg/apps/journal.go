@@ -0,0 +1,146 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kbrew-dev/kbrew/pkg/util"
+)
+
+// errJournalNotFound is returned when there is no journal of a previous run to resume
+var errJournalNotFound = errors.New("journal not found")
+
+// journal records the apps installed and the steps executed by a run so that an interrupted run
+// can be resumed without executing them again. It is written to disk after every recorded item.
+type journal struct {
+	mu   sync.Mutex
+	path string
+
+	Operation Method    `json:"operation"`
+	App       string    `json:"app"`
+	Namespace string    `json:"namespace,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Completed []string  `json:"completed"`
+}
+
+// newJournal returns an empty journal of the run of the app, stored in dir
+func newJournal(dir string, op Method, appName, namespace string) *journal {
+	return &journal{
+		path:      journalPath(dir, appName, namespace),
+		Operation: op,
+		App:       appName,
+		Namespace: namespace,
+		StartedAt: time.Now().UTC(),
+		Completed: []string{},
+	}
+}
+
+// loadJournal reads the journal of the previous run of the app from dir
+func loadJournal(dir string, appName, namespace string) (*journal, error) {
+	path := journalPath(dir, appName, namespace)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(errJournalNotFound, "no journal at %s", path)
+		}
+		return nil, errors.Wrapf(err, "Failed to read journal %s", path)
+	}
+	j := &journal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode journal %s", path)
+	}
+	return j, nil
+}
+
+// journalPath returns path of the journal file, cluster scoped apps are installed with empty namespace
+func journalPath(dir, appName, namespace string) string {
+	if namespace == "" {
+		return filepath.Join(dir, appName+".json")
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%s.json", appName, namespace))
+}
+
+// done checks if the item was completed by the run, a nil journal has no items
+func (j *journal) done(key string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, k := range j.Completed {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the completed item and writes the journal to disk
+func (j *journal) record(key string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Completed = append(j.Completed, key)
+	j.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode journal %s", j.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "Failed to create journal dir %s", filepath.Dir(j.path))
+	}
+	// Write to a temp file first so that an interrupted write does not corrupt the journal
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write journal %s", j.path)
+	}
+	return errors.Wrapf(os.Rename(tmp, j.path), "Failed to write journal %s", j.path)
+}
+
+// remove deletes the journal file once the run does not need to be resumed
+func (j *journal) remove() error {
+	if j == nil {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to remove journal %s", j.path)
+	}
+	return nil
+}
+
+// appKey identifies the installation of the app in the journal
+func appKey(appName, namespace string) string {
+	return fmt.Sprintf("app:%s/%s", namespace, appName)
+}
+
+// stepKey identifies the step of the app in the journal by its position in the recipe and the digest of its script,
+// so identical steps run more than once have distinct keys
+func stepKey(appName string, phase Phase, phaseIndex, stepIndex int, step string) string {
+	digest, _ := util.SHA256(strings.NewReader(step))
+	return fmt.Sprintf("step:%s/%s/%d/%d/%s", appName, phase, phaseIndex, stepIndex, digest)
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := loadJournal(dir, "kafka", "kafka"); !errors.Is(err, errJournalNotFound) {
+		t.Fatalf("expected journal not found error, got %v", err)
+	}
+
+	step := "kubectl create namespace kafka"
+	j := newJournal(dir, Install, "kafka", "kafka")
+	for _, key := range []string{appKey("cert-manager", ""), stepKey("kafka", PreInstallPhase, 0, 0, step)} {
+		if err := j.record(key); err != nil {
+			t.Fatalf("failed to record %s: %v", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kafka.kafka.json")); err != nil {
+		t.Fatalf("expected journal file to be written: %v", err)
+	}
+
+	loaded, err := loadJournal(dir, "kafka", "kafka")
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	for key, want := range map[string]bool{
+		appKey("cert-manager", ""):                             true,
+		stepKey("kafka", PreInstallPhase, 0, 0, step):          true,
+		stepKey("kafka", PostInstallPhase, 0, 0, step):         false,
+		stepKey("kafka", PreInstallPhase, 0, 0, step+" --dry"): false,
+		// Identical steps in the same phase or in another phase are distinct
+		stepKey("kafka", PreInstallPhase, 0, 1, step): false,
+		stepKey("kafka", PreInstallPhase, 1, 0, step): false,
+		appKey("kafka", "kafka"):                      false,
+	} {
+		if got := loaded.done(key); got != want {
+			t.Errorf("done(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	if err := loaded.remove(); err != nil {
+		t.Fatalf("failed to remove journal: %v", err)
+	}
+	if _, err := loadJournal(dir, "kafka", "kafka"); !errors.Is(err, errJournalNotFound) {
+		t.Fatalf("expected journal not found error after remove, got %v", err)
+	}
+
+	// Nil journal is used when journals are not maintained
+	var nilJournal *journal
+	if nilJournal.done(appKey("kafka", "kafka")) || nilJournal.record("key") != nil || nilJournal.remove() != nil {
+		t.Error("expected nil journal to be a no-op")
+	}
+}
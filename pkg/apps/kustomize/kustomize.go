@@ -0,0 +1,139 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kustomize
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+
+	"github.com/kbrew-dev/kbrew/pkg/apps/raw"
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/log"
+)
+
+// App represents K8s app defined with a kustomization
+type App struct {
+	app config.App
+	log *log.Logger
+	raw *raw.App
+}
+
+// New returns new instance of kustomize App
+func New(c config.App, log *log.Logger) (*App, error) {
+	r, err := raw.New(c, log)
+	if err != nil {
+		return nil, err
+	}
+	return &App{
+		app: c,
+		log: log,
+		raw: r,
+	}, nil
+}
+
+// Install builds the kustomization of the app and applies the resulting manifest.
+func (k *App) Install(ctx context.Context, name, namespace, version string, options map[string]string) error {
+	manifest, err := Render(k.app, name, namespace)
+	if err != nil {
+		return err
+	}
+	_, err = k.raw.ApplyManifest(ctx, manifest, name, namespace)
+	return err
+}
+
+// Upgrade applies the latest build of the kustomization and prunes the objects which are no longer part of it.
+func (k *App) Upgrade(ctx context.Context, name, namespace, version string, options map[string]string) error {
+	manifest, err := Render(k.app, name, namespace)
+	if err != nil {
+		return err
+	}
+	applied, err := k.raw.ApplyManifest(ctx, manifest, name, namespace)
+	if err != nil {
+		return err
+	}
+	return k.raw.Prune(ctx, applied, name, namespace)
+}
+
+// Uninstall deletes the objects of the kustomization build.
+func (k *App) Uninstall(ctx context.Context, name, namespace string) error {
+	manifest, err := Render(k.app, name, namespace)
+	if err != nil {
+		return err
+	}
+	return k.raw.DeleteManifest(ctx, manifest, name, namespace)
+}
+
+// Exists checks if any of the objects of the kustomization build is present in the cluster
+func (k *App) Exists(ctx context.Context, name, namespace string) (bool, error) {
+	manifest, err := Render(k.app, name, namespace)
+	if err != nil {
+		return false, err
+	}
+	return k.raw.ManifestExists(ctx, manifest, name, namespace)
+}
+
+// Search searches the app specified by name.
+func (k *App) Search(ctx context.Context, name string) (string, error) {
+	return k.raw.Search(ctx, name)
+}
+
+// Workloads returns K8s workload object reference list for the kustomize app
+func (k *App) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
+	manifest, err := Render(k.app, k.app.Name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return raw.ParseManifestYAML(manifest, namespace)
+}
+
+// Render builds the kustomization of the app installed in the namespace and patches the result with the recipe args.
+// The repository URL can be a local path, relative to the recipe, or a git URL with optional ref and subdir,
+// e.g https://github.com/org/repo//config/default?ref=v1.0.0
+func Render(c config.App, name, namespace string) (string, error) {
+	target := Target(c)
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), target)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to build kustomization %s", target)
+	}
+	manifest, err := resources.AsYaml()
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to encode kustomization %s", target)
+	}
+	return raw.PatchManifest(string(manifest), c.Args, name, namespace)
+}
+
+// Target returns the kustomization location of the app with local paths resolved against the recipe dir
+func Target(c config.App) string {
+	url := c.Repository.URL
+	if isRemote(url) || filepath.IsAbs(url) {
+		return url
+	}
+	return filepath.Join(c.RecipeDir, url)
+}
+
+func isRemote(url string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git::", "git@", "github.com/", "gitlab.com/", "bitbucket.org/"} {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
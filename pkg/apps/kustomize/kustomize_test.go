@@ -0,0 +1,96 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const (
+	kustomization = `resources:
+- deployment.yaml
+namePrefix: dev-
+`
+	deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx
+`
+)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-kustomize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overlay := filepath.Join(dir, "overlay")
+	if err := os.MkdirAll(overlay, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"kustomization.yaml": kustomization, "deployment.yaml": deployment} {
+		if err := ioutil.WriteFile(filepath.Join(overlay, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := config.App{
+		Repository: config.Repository{URL: "overlay", Type: config.Kustomize},
+		Args:       map[string]interface{}{"Deployment.dev-nginx.spec.replicas": 3},
+		RecipeDir:  dir,
+	}
+	manifest, err := Render(c, "nginx", "web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"name: dev-nginx", "replicas: 3", "kbrew.dev/app: nginx", "kbrew.dev/namespace: web"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("rendered manifest does not contain %q:\n%s", want, manifest)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	cases := map[string]struct {
+		url  string
+		want string
+	}{
+		"relative path": {url: "overlays/prod", want: "/recipes/overlays/prod"},
+		"absolute path": {url: "/opt/app", want: "/opt/app"},
+		"git url":       {url: "https://github.com/org/repo//config?ref=v1.0.0", want: "https://github.com/org/repo//config?ref=v1.0.0"},
+		"github path":   {url: "github.com/org/repo/config", want: "github.com/org/repo/config"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Target(config.App{Repository: config.Repository{URL: tc.url}, RecipeDir: "/recipes"})
+			if got != tc.want {
+				t.Errorf("Target() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
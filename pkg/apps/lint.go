@@ -0,0 +1,127 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/kube"
+)
+
+// LintIssue is a problem found in a recipe
+type LintIssue struct {
+	App     string
+	Recipe  string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s (%s): %s", i.App, i.Recipe, i.Message)
+}
+
+// Lint checks the recipe of the app and the recipes of its dependencies. The recipes are checked against the schema,
+// dependency recipes must exist in the same registry, templates and manifests must render and
+// args of raw and kustomize apps must match objects in the manifest.
+// Rendering the manifests requires access to the app repositories.
+func Lint(appName, appConfigPath string) []LintIssue {
+	issues := []LintIssue{}
+	lint(appName, appConfigPath, map[string]struct{}{}, &issues)
+	return issues
+}
+
+func lint(appName, appConfigPath string, visited map[string]struct{}, issues *[]LintIssue) {
+	if _, ok := visited[appConfigPath]; ok {
+		return
+	}
+	visited[appConfigPath] = struct{}{}
+	report := func(format string, a ...interface{}) {
+		*issues = append(*issues, LintIssue{App: appName, Recipe: appConfigPath, Message: fmt.Sprintf(format, a...)})
+	}
+
+	c, err := config.NewApp(appName, appConfigPath)
+	if err != nil {
+		report("%s", err.Error())
+		return
+	}
+
+	deps := []string{}
+	for _, phase := range c.App.PreInstall {
+		deps = append(deps, phase.Apps...)
+	}
+	for _, phase := range c.App.PostInstall {
+		deps = append(deps, phase.Apps...)
+	}
+	for _, dep := range deps {
+		depPath := dependencyPath(appConfigPath, dep)
+		if _, err := os.Stat(depPath); err != nil {
+			report("dependency %s: recipe %s not found in the registries", dep, depPath)
+			continue
+		}
+		lint(dep, depPath, visited, issues)
+	}
+
+	// Required args without default value are passed by the user at install time
+	for k, spec := range c.App.ArgsSpec {
+		spec.Required = false
+		c.App.ArgsSpec[k] = spec
+	}
+	if err := c.App.ResolveArgs(nil); err != nil {
+		report("%s", err.Error())
+		return
+	}
+	manifest, err := renderManifest(c, appName, resolveNamespace(c, ""))
+	if err != nil {
+		report("failed to render manifest: %s", err.Error())
+		return
+	}
+	if c.App.Repository.Type == config.Raw || c.App.Repository.Type == config.Kustomize {
+		unmatched, err := unmatchedArgs(manifest, c.App.Args)
+		if err != nil {
+			report("%s", err.Error())
+			return
+		}
+		for _, arg := range unmatched {
+			report("arg %s does not match any object in the manifest", arg)
+		}
+	}
+}
+
+// unmatchedArgs returns the args in <Kind>.<Name>.<FieldPath> format which do not refer to any object of the manifest
+func unmatchedArgs(manifest string, args map[string]interface{}) ([]string, error) {
+	objs, err := kube.DecodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	objects := map[string]struct{}{}
+	for _, obj := range objs {
+		objects[obj.GetKind()+"."+obj.GetName()] = struct{}{}
+	}
+	unmatched := []string{}
+	for arg := range args {
+		keys := strings.SplitN(arg, ".", 3)
+		if len(keys) < 3 {
+			continue
+		}
+		if _, ok := objects[keys[0]+"."+keys[1]]; !ok {
+			unmatched = append(unmatched, arg)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched, nil
+}
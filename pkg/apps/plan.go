@@ -0,0 +1,246 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const latestVersion = "latest"
+
+// Phase is the stage of the app lifecycle in which a step is executed
+type Phase string
+
+const (
+	// PreInstallPhase runs before installing the app
+	PreInstallPhase Phase = "pre-install"
+	// PostInstallPhase runs after installing the app
+	PostInstallPhase Phase = "post-install"
+	// PreCleanupPhase runs before uninstalling the app
+	PreCleanupPhase Phase = "pre-cleanup"
+	// PostCleanupPhase runs after uninstalling the app
+	PostCleanupPhase Phase = "post-cleanup"
+)
+
+// PlanAction is a single action AppRunner would perform
+type PlanAction struct {
+	// Method is set for the actions operating on apps
+	Method Method
+	// Step is set for the actions executing recipe steps
+	Step       string
+	Phase      Phase
+	App        string
+	Type       config.RepoType
+	Repository string
+	Version    string
+	Namespace  string
+	Args       map[string]interface{}
+	// Parent is the app which declares this app as dependency
+	Parent string
+	// RecipePath is the path of the app recipe file
+	RecipePath string
+	// RequiredBy is set for the dependency apps kept on uninstall since other installed apps need them
+	RequiredBy []string
+}
+
+// Plan is the ordered list of actions performed while running an operation on an app
+type Plan []PlanAction
+
+// Plan walks the recipe and its dependency recipes the same way Run does and returns the actions
+// Run would perform, without making any changes to the cluster
+func (r *AppRunner) Plan(appName, namespace, appConfigPath string) (Plan, error) {
+	if _, err := BuildGraph(appName, appConfigPath); err != nil {
+		return nil, err
+	}
+	plan := Plan{}
+	if err := r.plan(&plan, appName, namespace, appConfigPath, "", map[string]struct{}{}); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (r *AppRunner) plan(plan *Plan, appName, namespace, appConfigPath, parent string, visited map[string]struct{}) error {
+	if _, ok := visited[appConfigPath]; ok {
+		return nil
+	}
+	visited[appConfigPath] = struct{}{}
+	c, err := config.NewApp(appName, appConfigPath)
+	if err != nil {
+		return err
+	}
+	switch c.App.Repository.Type {
+	case config.Helm, config.Raw, config.Kustomize:
+	default:
+		return fmt.Errorf("unsupported app type %s", c.App.Repository.Type)
+	}
+	namespace = resolveNamespace(c, namespace)
+	if r.operation != Uninstall {
+		var overrides map[string]interface{}
+		if parent == "" {
+			overrides = r.overrides(appName, namespace)
+		}
+		if err := c.App.ResolveArgs(overrides); err != nil {
+			return err
+		}
+	}
+
+	appAction := PlanAction{
+		Method:     r.operation,
+		App:        appName,
+		Type:       c.App.Repository.Type,
+		Repository: c.App.Repository.URL,
+		Version:    c.App.Version,
+		Namespace:  namespace,
+		Args:       c.App.Args,
+		Parent:     parent,
+		RecipePath: appConfigPath,
+	}
+	if appAction.Version == "" {
+		appAction.Version = latestVersion
+	}
+	stepAction := func(phase Phase, step string) PlanAction {
+		return PlanAction{Step: step, Phase: phase, App: appName, Namespace: namespace, Parent: parent}
+	}
+
+	switch r.operation {
+	case Install, Upgrade:
+		for _, phase := range c.App.PreInstall {
+			for _, a := range phase.Apps {
+				if err := r.plan(plan, a, namespace, dependencyPath(appConfigPath, a), appName, visited); err != nil {
+					return err
+				}
+			}
+			for _, step := range phase.Steps {
+				*plan = append(*plan, stepAction(PreInstallPhase, step))
+			}
+		}
+		*plan = append(*plan, appAction)
+		for _, phase := range c.App.PostInstall {
+			for _, a := range phase.Apps {
+				if err := r.plan(plan, a, namespace, dependencyPath(appConfigPath, a), appName, visited); err != nil {
+					return err
+				}
+			}
+			for _, step := range phase.Steps {
+				*plan = append(*plan, stepAction(PostInstallPhase, step))
+			}
+		}
+	case Uninstall:
+		if users := r.requiredBy(appName, namespace); len(users) > 0 && parent != "" {
+			appAction.RequiredBy = users
+			*plan = append(*plan, appAction)
+			// Let the other apps depending on it reconsider the removal
+			delete(visited, appConfigPath)
+			return nil
+		}
+		r.removing = append(r.removing, appName)
+		defer func() { r.removing = r.removing[:len(r.removing)-1] }()
+		preInstall, postInstall := c.App.PreInstall, c.App.PostInstall
+		if r.opts.KeepDeps {
+			preInstall, postInstall = nil, nil
+		}
+		for _, step := range c.App.PreCleanup.Steps {
+			*plan = append(*plan, stepAction(PreCleanupPhase, step))
+		}
+		for _, phase := range postInstall {
+			for _, a := range phase.Apps {
+				if err := r.plan(plan, a, namespace, dependencyPath(appConfigPath, a), appName, visited); err != nil {
+					return err
+				}
+			}
+		}
+		*plan = append(*plan, appAction)
+		for _, phase := range preInstall {
+			for _, a := range phase.Apps {
+				if err := r.plan(plan, a, namespace, dependencyPath(appConfigPath, a), appName, visited); err != nil {
+					return err
+				}
+			}
+		}
+		for _, step := range c.App.PostCleanup.Steps {
+			*plan = append(*plan, stepAction(PostCleanupPhase, step))
+		}
+	default:
+		return fmt.Errorf("unsupported method %s", r.operation)
+	}
+	return nil
+}
+
+// String returns the human readable numbered list of plan actions
+func (p Plan) String() string {
+	var b bytes.Buffer
+	for i, a := range p {
+		ns := a.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		if a.Step != "" {
+			fmt.Fprintf(&b, "%d. run %s step for %s\n", i+1, a.Phase, a.App)
+			writeIndented(&b, strings.TrimSpace(a.Step))
+			continue
+		}
+		if len(a.RequiredBy) > 0 {
+			fmt.Fprintf(&b, "%d. keep app %s (still required by %s)\n", i+1, a.App, strings.Join(a.RequiredBy, ", "))
+			fmt.Fprintf(&b, "     namespace: %s\n", ns)
+			continue
+		}
+		if a.Parent != "" {
+			fmt.Fprintf(&b, "%d. %s app %s (dependency of %s)\n", i+1, a.Method, a.App, a.Parent)
+		} else {
+			fmt.Fprintf(&b, "%d. %s app %s\n", i+1, a.Method, a.App)
+		}
+		fmt.Fprintf(&b, "     type: %s\n", a.Type)
+		fmt.Fprintf(&b, "     repository: %s\n", a.Repository)
+		fmt.Fprintf(&b, "     version: %s\n", a.Version)
+		fmt.Fprintf(&b, "     namespace: %s\n", ns)
+		if a.Method == Uninstall || len(a.Args) == 0 {
+			continue
+		}
+		fmt.Fprintln(&b, "     args:")
+		writeIndented(&b, formatArgs(a.Args))
+	}
+	return b.String()
+}
+
+func writeIndented(b *bytes.Buffer, s string) {
+	for _, line := range strings.Split(s, "\n") {
+		fmt.Fprintf(b, "       %s\n", line)
+	}
+}
+
+// formatArgs returns args as YAML sorted by keys
+func formatArgs(args map[string]interface{}) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := []string{}
+	for _, k := range keys {
+		v, err := yaml.Marshal(args[k])
+		if err != nil {
+			v = []byte(fmt.Sprintf("%v", args[k]))
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", k, strings.TrimSpace(string(v))))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -18,10 +18,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 	"text/tabwriter"
@@ -32,6 +28,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 
@@ -42,17 +39,19 @@ import (
 	"github.com/kbrew-dev/kbrew/pkg/config"
 	"github.com/kbrew-dev/kbrew/pkg/kube"
 	"github.com/kbrew-dev/kbrew/pkg/log"
+	"github.com/kbrew-dev/kbrew/pkg/util"
 	"github.com/kbrew-dev/kbrew/pkg/yaml"
 )
 
-type method string
-
 const (
-	install   method = "apply"
-	uninstall method = "delete"
-	// upgrade   method = "apply" // unused
-
-	evalExpression = `select(.kind  == "%s" and .metadata.name == "%s").%s |= %v`
+	evalExpression  = `select(.kind  == "%s" and .metadata.name == "%s").%s |= %v`
+	labelExpression = `select(.kind != null).metadata.labels."%s" |= "%s"`
+
+	// appLabel is set on all the objects of the app to find the objects to prune on upgrade
+	appLabel = "kbrew.dev/app"
+	// namespaceLabel is set on all the objects of the app so that upgrade prunes only the objects of the app
+	// installed in the namespace and not the ones of the same app installed in the other namespaces
+	namespaceLabel = "kbrew.dev/namespace"
 )
 
 var yamlDelimiter = regexp.MustCompile(`(?m)^---$`)
@@ -63,6 +62,7 @@ type App struct {
 	log      *log.Logger
 	kubeCli  kubernetes.Interface
 	osAppCli osversioned.Interface
+	dynCli   *kube.DynamicClient
 }
 
 // New returns new instance of raw App
@@ -83,95 +83,159 @@ func New(c config.App, log *log.Logger) (*App, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to create OpenShift client")
 	}
+	dynCli, err := kube.NewDynamicClient()
+	if err != nil {
+		return nil, err
+	}
 
 	rApp := &App{
 		app:      c,
 		log:      log,
 		kubeCli:  cli,
 		osAppCli: osCli,
+		dynCli:   dynCli,
 	}
 	return rApp, nil
 }
 
 // Install installs the app specified by name, version and namespace.
 func (r *App) Install(ctx context.Context, name, namespace, version string, options map[string]string) error {
-	manifest, err := getManifest(r.app.Repository.URL)
+	_, err := r.apply(ctx, name, namespace)
+	return err
+}
+
+// Upgrade applies the latest manifest of the app specified by name and namespace
+// and prunes the objects which are no longer part of the manifest.
+func (r *App) Upgrade(ctx context.Context, name, namespace, version string, options map[string]string) error {
+	applied, err := r.apply(ctx, name, namespace)
 	if err != nil {
 		return err
 	}
+	return r.Prune(ctx, applied, name, namespace)
+}
 
-	patchedManifest, err := patchManifest(manifest, r.app.Args)
+// Render returns the manifest of the app installed in the namespace patched with the recipe args
+func Render(c config.App, name, namespace string) (string, error) {
+	manifest, err := getManifest(c)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return PatchManifest(manifest, c.Args, name, namespace)
+}
 
-	if err := kube.CreateNamespace(ctx, r.kubeCli, namespace); err != nil && !k8sErrors.IsAlreadyExists(err) {
-		return err
+// PatchManifest patches the objects in the manifest with the recipe args and sets the app labels on them
+func PatchManifest(manifest string, args map[string]interface{}, name, namespace string) (string, error) {
+	patchedManifest, err := patchManifest(manifest, args)
+	if err != nil {
+		return "", err
 	}
 
-	// TODO(@prasad): Use go sdks
-	out, err := kubectlCommand(ctx, install, name, namespace, patchedManifest)
+	// Label objects with app name and namespace so that the objects removed from the manifest can be pruned on upgrade
+	e := yaml.NewEvaluator()
+	patchedManifest, err = e.Eval(patchedManifest, fmt.Sprintf(labelExpression, appLabel, name))
 	if err != nil {
-		r.log.Debug(out)
-		return err
+		return "", err
 	}
-	r.log.Debug(out)
-	r.log.Debugf("Waiting for components to be ready for %s", name)
-	return r.waitForReady(ctx, namespace)
+	return e.Eval(patchedManifest, fmt.Sprintf(labelExpression, namespaceLabel, labelNamespace(namespace)))
 }
 
-// Uninstall uninstalls the app specified by name and namespace.
-func (r *App) Uninstall(ctx context.Context, name, namespace string) error {
-	// TODO(@prasad): Use go sdks
-	out, err := kubectlCommand(ctx, uninstall, name, namespace, r.app.Repository.URL)
-	r.log.Debug(out)
-	return err
+// labelNamespace returns the value of the namespace label, objects of the apps without namespace go to the default namespace
+func labelNamespace(namespace string) string {
+	if namespace == "" {
+		return corev1.NamespaceDefault
+	}
+	return namespace
 }
 
-// Search searches the app specified by name.
-func (r *App) Search(ctx context.Context, name string) (string, error) {
-	return printList(r.app), nil
+// Digest returns the sha256 digest of the manifest of the app to be set in the recipe
+func Digest(c config.App) (string, error) {
+	return util.Digest(c.Repository.URL)
 }
 
-func kubectlCommand(ctx context.Context, m method, name, namespace, manifest string) (string, error) {
-	var c *exec.Cmd
-	switch m {
-	case install:
-		c = exec.CommandContext(ctx, "kubectl", string(m), "-f", "-")
-		// Pass the manifest on STDIN
-		c.Stdin = strings.NewReader(manifest)
-	default:
-		c = exec.CommandContext(ctx, "kubectl", string(m), "-f", manifest)
+func (r *App) apply(ctx context.Context, name, namespace string) ([]*unstructured.Unstructured, error) {
+	patchedManifest, err := Render(r.app, name, namespace)
+	if err != nil {
+		return nil, err
 	}
+	return r.ApplyManifest(ctx, patchedManifest, name, namespace)
+}
 
-	if namespace != "" {
-		c.Args = append(c.Args, "--namespace", namespace)
+// ApplyManifest applies the rendered manifest of the app and waits for the workloads to be ready
+func (r *App) ApplyManifest(ctx context.Context, manifest, name, namespace string) ([]*unstructured.Unstructured, error) {
+	if err := kube.CreateNamespace(ctx, r.kubeCli, namespace); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return nil, err
 	}
-	c.Stderr = os.Stderr
-	output, err := c.Output()
-	return string(output), err
-}
 
-// Workloads returns K8s workload object reference list for the raw app
-func (r *App) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
-	resp, err := http.Get(r.app.Repository.URL)
+	applied, err := r.dynCli.ApplyManifest(ctx, manifest, namespace)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to read resource manifest from URL")
+		return nil, errors.Wrapf(err, "Failed to apply manifest of %s", name)
+	}
+	for _, obj := range applied {
+		r.log.Debugf("Applied %s", kube.ObjectName(obj))
 	}
-	defer resp.Body.Close()
 
-	data, err := ioutil.ReadAll(resp.Body)
+	workloads, err := ParseManifestYAML(manifest, namespace)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to read resource manifest from URL")
+		return nil, err
 	}
-	return ParseManifestYAML(string(data), namespace)
+	r.log.Debugf("Waiting for components to be ready for %s", name)
+	return applied, r.waitForReady(ctx, workloads)
 }
 
-func (r *App) waitForReady(ctx context.Context, namespace string) error {
-	workloads, err := r.Workloads(ctx, namespace)
+// Prune deletes the objects of the app which are not in the applied objects
+func (r *App) Prune(ctx context.Context, applied []*unstructured.Unstructured, name, namespace string) error {
+	selector := fmt.Sprintf("%s=%s,%s=%s", appLabel, name, namespaceLabel, labelNamespace(namespace))
+	pruned, err := r.dynCli.Prune(ctx, applied, namespace, selector)
+	for _, p := range pruned {
+		r.log.Debugf("Pruned %s", p)
+	}
+	return errors.Wrapf(err, "Failed to prune objects of %s", name)
+}
+
+// DeleteManifest deletes the objects in the rendered manifest of the app
+func (r *App) DeleteManifest(ctx context.Context, manifest, name, namespace string) error {
+	return errors.Wrapf(r.dynCli.DeleteManifest(ctx, manifest, namespace), "Failed to delete manifest of %s", name)
+}
+
+// Uninstall uninstalls the app specified by name and namespace.
+func (r *App) Uninstall(ctx context.Context, name, namespace string) error {
+	patchedManifest, err := Render(r.app, name, namespace)
 	if err != nil {
 		return err
 	}
+	return r.DeleteManifest(ctx, patchedManifest, name, namespace)
+}
+
+// Exists checks if any of the objects in the manifest of the app is present in the cluster
+func (r *App) Exists(ctx context.Context, name, namespace string) (bool, error) {
+	patchedManifest, err := Render(r.app, name, namespace)
+	if err != nil {
+		return false, err
+	}
+	return r.ManifestExists(ctx, patchedManifest, name, namespace)
+}
+
+// ManifestExists checks if any of the objects in the rendered manifest of the app is present in the cluster
+func (r *App) ManifestExists(ctx context.Context, manifest, name, namespace string) (bool, error) {
+	exists, err := r.dynCli.ManifestExists(ctx, manifest, namespace)
+	return exists, errors.Wrapf(err, "Failed to check objects of %s", name)
+}
+
+// Search searches the app specified by name.
+func (r *App) Search(ctx context.Context, name string) (string, error) {
+	return printList(r.app), nil
+}
+
+// Workloads returns K8s workload object reference list for the raw app
+func (r *App) Workloads(ctx context.Context, namespace string) ([]corev1.ObjectReference, error) {
+	manifest, err := getManifest(r.app)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifestYAML(manifest, namespace)
+}
+
+func (r *App) waitForReady(ctx context.Context, workloads []corev1.ObjectReference) error {
 	for _, wRef := range workloads {
 		switch wRef.Kind {
 		case "Pod":
@@ -268,17 +332,14 @@ func patchManifest(manifest string, patches map[string]interface{}) (string, err
 	return patchedManifest, nil
 }
 
-func getManifest(url string) (string, error) {
-	resp, err := http.Get(url)
+// getManifest downloads the manifest of the app and verifies it against the sha256 digest set in the recipe
+func getManifest(c config.App) (string, error) {
+	manifest, err := util.FetchURL(c.Repository.URL)
 	if err != nil {
 		return "", errors.Wrap(err, "Error fetching from app URL")
 	}
-
-	defer resp.Body.Close()
-
-	manifest, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", errors.Wrap(err, "Error fetching from app URL")
+	if err := util.VerifySHA256(manifest, c.SHA256); err != nil {
+		return "", errors.Wrapf(err, "Failed to verify manifest %s", c.Repository.URL)
 	}
 	return string(manifest), nil
 }
@@ -0,0 +1,173 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/release"
+)
+
+// rollbackTimeout is the time given to unwind the failed installation.
+// The context of the run cannot be used since it might have been expired already.
+const rollbackTimeout = 15 * time.Minute
+
+// existsTimeout is the time given to check if the app was installed before the run
+const existsTimeout = time.Minute
+
+type itemKind string
+
+const (
+	appItem  itemKind = "app"
+	stepItem itemKind = "step"
+)
+
+// completedItem is an app or a step executed by AppRunner while installing an app
+type completedItem struct {
+	kind      itemKind
+	appName   string
+	namespace string
+	app       App
+	config    *config.AppConfig
+	step      string
+	// installed is false if the run failed before installing the app
+	installed bool
+}
+
+// trackApp records the app as installed by the run, it is called before installing the app.
+// Apps that were present before the run started are not recorded so that rollback does not remove them.
+func (r *AppRunner) trackApp(app App, c *config.AppConfig, appName, namespace string, installed bool) {
+	if !r.opts.Atomic || r.operation != Install {
+		return
+	}
+	if r.tracked(appName, namespace) {
+		return
+	}
+	if r.existed(app, appName, namespace) {
+		r.log.Debugf("App %s already installed in %s namespace, it won't be rolled back on failure", appName, namespace)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed = append(r.completed, completedItem{
+		kind:      appItem,
+		appName:   appName,
+		namespace: namespace,
+		app:       app,
+		config:    c,
+		installed: installed,
+	})
+}
+
+// tracked checks if the app is recorded as installed by the run
+func (r *AppRunner) tracked(appName, namespace string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, item := range r.completed {
+		if item.kind == appItem && item.appName == appName && item.namespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// existed checks if the app was installed before the run, either recorded as deployed in the release store
+// or present in the cluster, e.g installed with helm directly. The app is assumed to exist if the check fails.
+func (r *AppRunner) existed(app App, appName, namespace string) bool {
+	// The context of the run is not used since the app is also tracked after the run failed, e.g timed out
+	ctx, cancel := context.WithTimeout(context.Background(), existsTimeout)
+	defer cancel()
+	if r.releases != nil {
+		rel, err := r.releases.Get(ctx, appName, namespace)
+		if err == nil && rel.Status == release.StatusDeployed {
+			return true
+		}
+	}
+	exists, err := app.Exists(ctx, appName, namespace)
+	if err != nil {
+		r.log.Warnf("Failed to check if app %s is already installed, it won't be rolled back on failure. %s", appName, err.Error())
+		return true
+	}
+	return exists
+}
+
+// trackStep records the step executed by the run
+func (r *AppRunner) trackStep(appName, step string) {
+	if !r.opts.Atomic || r.operation != Install {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed = append(r.completed, completedItem{
+		kind:    stepItem,
+		appName: appName,
+		step:    step,
+	})
+}
+
+// rollback unwinds the apps installed by the run in reverse order.
+// Apps are removed with the cleanup steps declared in the recipes since the executed steps can not be reverted.
+func (r *AppRunner) rollback() {
+	if len(r.completed) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	r.log.Warn("Installation failed, rolling back the changes...")
+	for i := len(r.completed) - 1; i >= 0; i-- {
+		item := r.completed[i]
+		if item.kind == stepItem {
+			r.log.Debugf("Step executed for %s can not be reverted, relying on cleanup steps. Step: %s", item.appName, item.step)
+			continue
+		}
+		r.status.Start(item.appName, fmt.Sprintf("Rolling back app %s from %s namespace", item.appName, item.namespace))
+		if err := r.cleanup(ctx, item); err != nil {
+			r.status.Error(item.appName)
+			r.log.Warnf("Failed to roll back app - %s.\nYou need to cleanup few resources manually. App: %s, Namespace: %s\n", err, item.appName, item.namespace)
+			continue
+		}
+		r.status.Success(item.appName)
+		r.deleteRelease(item.appName, item.namespace)
+	}
+	r.completed = nil
+}
+
+// cleanup runs pre-cleanup steps, uninstalls the app and runs post-cleanup steps for the app
+func (r *AppRunner) cleanup(ctx context.Context, item completedItem) error {
+	for _, a := range item.config.App.PreCleanup.Steps {
+		out, err := r.execCommand(ctx, a)
+		if err != nil {
+			return err
+		}
+		r.log.Debug(out)
+	}
+	if item.installed {
+		if err := item.app.Uninstall(ctx, item.appName, item.namespace); err != nil {
+			return err
+		}
+	}
+	for _, a := range item.config.App.PostCleanup.Steps {
+		out, err := r.execCommand(ctx, a)
+		if err != nil {
+			return err
+		}
+		r.log.Debug(out)
+	}
+	return nil
+}
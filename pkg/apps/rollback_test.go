@@ -0,0 +1,71 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAtomicInstallRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cleanupLog := filepath.Join(dir, "cleanup.log")
+	writeRecipe(t, dir, "stack", `  pre_install:
+  - apps: [db, cache]
+  post_install:
+  - apps: [broken]
+`)
+	writeRecipe(t, dir, "db", "")
+	writeRecipe(t, dir, "cache", "")
+	writeRecipe(t, dir, "broken", `  pre_install:
+  - steps: ["exit 1"]
+  pre_cleanup:
+    steps: ["echo pre-cleanup >> `+cleanupLog+`"]
+  post_cleanup:
+    steps: ["echo post-cleanup >> `+cleanupLog+`"]
+`)
+
+	// cache is installed before the run, e.g with helm directly
+	cluster := &fakeCluster{existing: map[string]bool{"cache": true}}
+	r := newFakeRunner(Install, cluster, nil, Options{Atomic: true})
+	if err := r.Run(context.Background(), "stack", "default", filepath.Join(dir, "stack.yaml")); err == nil {
+		t.Fatal("expected install to fail")
+	}
+
+	if diff := cmp.Diff([]string{"db", "cache", "stack"}, cluster.installs); diff != "" {
+		t.Errorf("installs mismatch (-want +got):\n%s", diff)
+	}
+	// Apps are removed in the reverse order, broken is only cleaned up since it failed before being installed
+	if diff := cmp.Diff([]string{"stack", "db"}, cluster.uninstalls); diff != "" {
+		t.Errorf("uninstalls mismatch (-want +got):\n%s", diff)
+	}
+	out, err := ioutil.ReadFile(cleanupLog)
+	if err != nil {
+		t.Fatalf("cleanup steps of broken not executed: %v", err)
+	}
+	if got := strings.Fields(string(out)); !cmp.Equal([]string{"pre-cleanup", "post-cleanup"}, got) {
+		t.Errorf("unexpected cleanup steps %v", got)
+	}
+}
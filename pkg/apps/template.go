@@ -0,0 +1,136 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kbrew-dev/kbrew/pkg/apps/helm"
+	"github.com/kbrew-dev/kbrew/pkg/apps/kustomize"
+	"github.com/kbrew-dev/kbrew/pkg/apps/raw"
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/kube"
+)
+
+// RenderedApp holds the final manifest of an app
+type RenderedApp struct {
+	Name      string
+	Namespace string
+	Type      config.RepoType
+	Manifest  string
+}
+
+// Render returns the fully rendered manifests of the app and all its dependency apps in the installation order.
+// Manifests are rendered locally without accessing the cluster. Overrides replace the recipe args of the app, same as on install.
+func Render(appName, namespace, appConfigPath string, overrides map[string]interface{}) ([]RenderedApp, error) {
+	plan, err := NewAppRunner(Install, nil, nil, nil, Options{Overrides: overrides}).Plan(appName, namespace, appConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	rendered := []RenderedApp{}
+	for _, a := range plan {
+		if a.Step != "" {
+			continue
+		}
+		c, err := config.NewApp(a.App, a.RecipePath)
+		if err != nil {
+			return nil, err
+		}
+		// Render with the args resolved by the plan, same as the ones install applies
+		c.App.Args = a.Args
+		manifest, err := renderManifest(c, a.App, a.Namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to render %s app", a.App)
+		}
+		rendered = append(rendered, RenderedApp{
+			Name:      a.App,
+			Namespace: a.Namespace,
+			Type:      a.Type,
+			Manifest:  manifest,
+		})
+	}
+	return rendered, nil
+}
+
+func renderManifest(c *config.AppConfig, appName, namespace string) (string, error) {
+	switch c.App.Repository.Type {
+	case config.Helm:
+		return helm.Render(c.App, appName, namespace)
+	case config.Raw:
+		return raw.Render(c.App, appName, namespace)
+	case config.Kustomize:
+		return kustomize.Render(c.App, appName, namespace)
+	default:
+		return "", fmt.Errorf("unsupported app type %s", c.App.Repository.Type)
+	}
+}
+
+// Digest returns the sha256 digest of the manifest or the chart archive downloaded for the app,
+// which can be set in the sha256 field of the recipe
+func Digest(appName, appConfigPath string) (string, error) {
+	c, err := config.NewApp(appName, appConfigPath)
+	if err != nil {
+		return "", err
+	}
+	switch c.App.Repository.Type {
+	case config.Helm:
+		return helm.Digest(c.App, appName)
+	case config.Raw:
+		return raw.Digest(c.App)
+	case config.Kustomize:
+		return "", fmt.Errorf("sha256 digest is not supported for %s apps, pin the git ref of the kustomization instead", config.Kustomize)
+	default:
+		return "", fmt.Errorf("unsupported app type %s", c.App.Repository.Type)
+	}
+}
+
+// WriteManifests writes the rendered manifests as a single multi-document YAML
+func WriteManifests(w io.Writer, rendered []RenderedApp) error {
+	for _, a := range rendered {
+		if _, err := fmt.Fprintf(w, "---\n# kbrew app: %s, type: %s\n%s\n", a.Name, a.Type, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(a.Manifest), "---"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff writes the differences between the rendered manifests of the app and its dependency apps
+// and the objects currently in the cluster
+func Diff(ctx context.Context, appName, namespace, appConfigPath string, overrides map[string]interface{}, w io.Writer) error {
+	rendered, err := Render(appName, namespace, appConfigPath, overrides)
+	if err != nil {
+		return err
+	}
+	cli, err := kube.NewDynamicClient()
+	if err != nil {
+		return err
+	}
+	for _, a := range rendered {
+		fmt.Fprintf(w, "# kbrew app: %s, type: %s\n", a.Name, a.Type)
+		changed, err := cli.Diff(ctx, a.Manifest, a.Namespace, w)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to compute diff for %s app", a.Name)
+		}
+		if !changed {
+			fmt.Fprintln(w, "No changes")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const deploymentManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 1
+`
+
+func TestRenderResolvesArgs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, deploymentManifest)
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "kbrew-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	recipe := fmt.Sprintf(`apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: %s/nginx.yaml
+    type: raw
+  args_spec:
+    Deployment.nginx.spec.replicas:
+      type: int
+      default: 3
+`, srv.URL)
+	path := filepath.Join(dir, "nginx.yaml")
+	if err := ioutil.WriteFile(path, []byte(recipe), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := Render("nginx", "default", path, nil)
+	if err != nil {
+		t.Fatalf("failed to render app: %v", err)
+	}
+	if len(rendered) != 1 {
+		t.Fatalf("expected one rendered app, got %d", len(rendered))
+	}
+	if !strings.Contains(rendered[0].Manifest, "replicas: 3") {
+		t.Errorf("expected args_spec default in the manifest, got\n%s", rendered[0].Manifest)
+	}
+
+	rendered, err = Render("nginx", "default", path, map[string]interface{}{"Deployment.nginx.spec.replicas": 5})
+	if err != nil {
+		t.Fatalf("failed to render app with overrides: %v", err)
+	}
+	if !strings.Contains(rendered[0].Manifest, "replicas: 5") {
+		t.Errorf("expected overridden arg in the manifest, got\n%s", rendered[0].Manifest)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ArgType is the type of the value of a recipe arg
+type ArgType string
+
+const (
+	// ArgString is a string arg
+	ArgString ArgType = "string"
+	// ArgInt is an integer arg
+	ArgInt ArgType = "int"
+	// ArgNumber is an integer or a floating point arg
+	ArgNumber ArgType = "number"
+	// ArgBool is a boolean arg
+	ArgBool ArgType = "bool"
+	// ArgList is a list arg
+	ArgList ArgType = "list"
+	// ArgMap is a map arg
+	ArgMap ArgType = "map"
+)
+
+// ArgSpec documents a recipe arg and constrains its value
+type ArgSpec struct {
+	Type        ArgType       `yaml:"type,omitempty"`
+	Default     interface{}   `yaml:"default,omitempty"`
+	Description string        `yaml:"description,omitempty"`
+	Enum        []interface{} `yaml:"enum,omitempty"`
+	Required    bool          `yaml:"required,omitempty"`
+	Pattern     string        `yaml:"pattern,omitempty"`
+}
+
+// ErrInvalidArgs is returned when the args do not satisfy the args spec of the recipe
+var ErrInvalidArgs = errors.New("invalid args")
+
+// ResolveArgs sets the final args of the app: defaults from the args spec, overridden by the recipe args,
+// overridden by the user overrides. The result is validated against the args spec.
+func (a *App) ResolveArgs(overrides map[string]interface{}) error {
+	args := map[string]interface{}{}
+	for k, spec := range a.ArgsSpec {
+		if spec.Default != nil {
+			args[k] = spec.Default
+		}
+	}
+	a.Args = MergeArgs(MergeArgs(args, a.Args), overrides)
+	if msgs := validateArgKeys(*a); len(msgs) != 0 {
+		return errors.Wrapf(fmt.Errorf("%w: %s", ErrInvalidArgs, strings.Join(msgs, "; ")), "app %s", a.Name)
+	}
+	return errors.Wrapf(ValidateArgs(a.ArgsSpec, a.Args), "app %s", a.Name)
+}
+
+// ValidateArgs checks the args against the args spec and returns all the violations.
+// Args which are not declared in the spec are not validated.
+func ValidateArgs(specs map[string]ArgSpec, args map[string]interface{}) error {
+	keys := make([]string, 0, len(specs))
+	for k := range specs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var msgs []string
+	for _, k := range keys {
+		if err := validateArg(specs[k], args[k]); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", k, err.Error()))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidArgs, strings.Join(msgs, "; "))
+}
+
+func validateArg(spec ArgSpec, value interface{}) error {
+	if value == nil || value == "" {
+		if spec.Required {
+			return errors.New("required arg is not set")
+		}
+		return nil
+	}
+	if spec.Type != "" && !hasType(spec.Type, value) {
+		return errors.Errorf("expected %s value, got %v", spec.Type, value)
+	}
+	if len(spec.Enum) != 0 {
+		found := false
+		for _, e := range spec.Enum {
+			if fmt.Sprintf("%v", e) == fmt.Sprintf("%v", value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("value %v is not one of %s", value, FormatEnum(spec.Enum))
+		}
+	}
+	if spec.Pattern != "" {
+		re, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern %s in args spec", spec.Pattern)
+		}
+		if !re.MatchString(fmt.Sprintf("%v", value)) {
+			return errors.Errorf("value %v does not match pattern %s", value, spec.Pattern)
+		}
+	}
+	return nil
+}
+
+func hasType(t ArgType, value interface{}) bool {
+	switch t {
+	case ArgString:
+		_, ok := value.(string)
+		return ok
+	case ArgInt:
+		switch v := value.(type) {
+		case int, int32, int64, uint, uint32, uint64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case ArgNumber:
+		switch value.(type) {
+		case int, int32, int64, uint, uint32, uint64, float32, float64:
+			return true
+		}
+		return false
+	case ArgBool:
+		_, ok := value.(bool)
+		return ok
+	case ArgList:
+		_, ok := value.([]interface{})
+		return ok
+	case ArgMap:
+		switch value.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// FormatEnum returns the allowed values of an arg as a comma separated list
+func FormatEnum(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for _, e := range enum {
+		values = append(values, fmt.Sprintf("%v", e))
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestValidateArgs(t *testing.T) {
+	specs := map[string]ArgSpec{
+		"replicaCount": {Type: ArgInt},
+		"cpu":          {Type: ArgNumber},
+		"enabled":      {Type: ArgBool},
+		"tolerations":  {Type: ArgList},
+		"resources":    {Type: ArgMap},
+		"storageClass": {Type: ArgString, Required: true, Enum: []interface{}{"standard", "fast"}},
+		"image.tag":    {Pattern: `^v\d+\.\d+\.\d+$`},
+	}
+	valid := map[string]interface{}{
+		"replicaCount": float64(3),
+		"cpu":          0.5,
+		"enabled":      true,
+		"tolerations":  []interface{}{"a"},
+		"resources":    map[interface{}]interface{}{"limits": "1"},
+		"storageClass": "fast",
+		"image.tag":    "v1.2.3",
+		"undeclared":   "anything",
+	}
+
+	cases := map[string]struct {
+		override map[string]interface{}
+		wantErr  bool
+	}{
+		"valid args":        {},
+		"missing required":  {override: map[string]interface{}{"storageClass": ""}, wantErr: true},
+		"fractional int":    {override: map[string]interface{}{"replicaCount": 2.5}, wantErr: true},
+		"string for int":    {override: map[string]interface{}{"replicaCount": "3"}, wantErr: true},
+		"string for bool":   {override: map[string]interface{}{"enabled": "true"}, wantErr: true},
+		"map for list":      {override: map[string]interface{}{"tolerations": map[string]interface{}{}}, wantErr: true},
+		"value not in enum": {override: map[string]interface{}{"storageClass": "slow"}, wantErr: true},
+		"pattern mismatch":  {override: map[string]interface{}{"image.tag": "latest"}, wantErr: true},
+		"optional unset":    {override: map[string]interface{}{"replicaCount": nil}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateArgs(specs, MergeArgs(valid, tc.override))
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidArgs) {
+					t.Fatalf("expected invalid args error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveArgs(t *testing.T) {
+	app := App{
+		Name: "nginx",
+		Args: map[string]interface{}{"replicaCount": 2},
+		ArgsSpec: map[string]ArgSpec{
+			"replicaCount": {Type: ArgInt, Default: 1},
+			"image.tag":    {Type: ArgString, Default: "latest"},
+			"storageClass": {Type: ArgString, Default: "standard"},
+		},
+	}
+	if err := app.ResolveArgs(map[string]interface{}{"storageClass": "fast"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]interface{}{"replicaCount": 2, "image.tag": "latest", "storageClass": "fast"}
+	if diff := cmp.Diff(want, app.Args); diff != "" {
+		t.Errorf("ResolveArgs() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := app.ResolveArgs(map[string]interface{}{"replicaCount": "two"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("expected invalid args error, got %v", err)
+	}
+}
@@ -36,13 +36,24 @@ type RepoType string
 // ConfigDir represents dir path of kbrew config
 var ConfigDir string
 
+const (
+	// HomeEnv is the env var holding the kbrew config dir
+	HomeEnv = "KBREW_HOME"
+
+	defaultConfigDirName = ".kbrew"
+)
+
 const (
 	// Raw repo type means the apps in the repo are raw apps
 	Raw RepoType = "raw"
 	// Helm repo means the apps in the repo are helm apps
 	Helm RepoType = "helm"
+	// Kustomize repo means the apps in the repo are kustomizations
+	Kustomize RepoType = "kustomize"
 	// RegistriesDirName represents the dir name within ConfigDir holding all the kbrew registries
 	RegistriesDirName = "registries"
+	// JournalsDirName represents the dir name within ConfigDir holding the journals of the install runs
+	JournalsDirName = "journals"
 
 	// Analytics setting flags
 
@@ -54,8 +65,20 @@ const (
 
 // KbrewConfig is a kbrew config stored at CONFIG_DIR/config.yaml
 type KbrewConfig struct {
-	AnalyticsUUID    string `yaml:"analyticsUUID"`
-	AnalyticsEnabled bool   `yaml:"analyticsEnabled"`
+	AnalyticsUUID    string         `yaml:"analyticsUUID"`
+	AnalyticsEnabled bool           `yaml:"analyticsEnabled"`
+	RegistryAuth     []RegistryAuth `yaml:"registryAuth,omitempty"`
+	// RegistryPriority lists the registries in the order recipes are looked up in them
+	RegistryPriority []string `yaml:"registryPriority,omitempty"`
+}
+
+// RegistryAuth holds the credentials used to clone and update the registries hosted on the git host.
+// Token is used for https URLs and SSHKey is the path of the private key used for ssh URLs.
+type RegistryAuth struct {
+	Host     string `yaml:"host"`
+	Username string `yaml:"username,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+	SSHKey   string `yaml:"sshKey,omitempty"`
 }
 
 // AppConfig is the kbrew recipe configuration
@@ -68,6 +91,9 @@ type AppConfig struct {
 // App hold app details set in kbrew recipe
 type App struct {
 	Args        map[string]interface{} `yaml:"args,omitempty"`
+	ArgsSpec    map[string]ArgSpec     `yaml:"args_spec,omitempty"`
+	Values      map[string]interface{} `yaml:"values,omitempty"`
+	ValuesFiles []string               `yaml:"values_files,omitempty"`
 	Repository  Repository             `yaml:"repository"`
 	Name        string                 `yaml:"name,omitempty"`
 	Namespace   string                 `yaml:"namespace,omitempty"`
@@ -78,6 +104,8 @@ type App struct {
 	PostInstall []PostInstall          `yaml:"post_install,omitempty"`
 	PreCleanup  AppCleanup             `yaml:"pre_cleanup,omitempty"`
 	PostCleanup AppCleanup             `yaml:"post_cleanup,omitempty"`
+	// RecipeDir is the dir of the recipe file, relative paths in the recipe are resolved against it
+	RecipeDir string `yaml:"-"`
 }
 
 // Repository is the repo for kbrew app
@@ -124,12 +152,13 @@ func NewApp(name, path string) (*AppConfig, error) {
 		return nil, err
 	}
 
+	// Recipes can be rendered without cluster access, lookup function returns empty result in that case
 	k8sconfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{},
 	).ClientConfig()
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to load Kubernetes config")
+		k8sconfig = nil
 	}
 
 	e := engine.NewEngine(k8sconfig)
@@ -138,13 +167,14 @@ func NewApp(name, path string) (*AppConfig, error) {
 		return nil, err
 	}
 
-	if len(b) != 0 {
-		err = yaml.Unmarshal([]byte(v), c)
-		if err != nil {
-			return nil, err
-		}
+	if err := yaml.UnmarshalStrict([]byte(v), c); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse recipe %s", path)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to validate recipe %s", path)
 	}
 	c.App.Name = name
+	c.App.RecipeDir = filepath.Dir(path)
 	return c, nil
 }
 
@@ -158,18 +188,12 @@ func NewKbrew() (*KbrewConfig, error) {
 	return kc, nil
 }
 
-// InitConfig initializes ConfigDir.
+// InitConfig initializes ConfigDir and reads the kbrew config from it.
 // If ConfigDir does not exists, create it
 func InitConfig() {
-	if ConfigDir != "" {
-		return
-	}
-	// Find home directory.
-	home, err := homedir.Dir()
+	dir, err := resolveConfigDir(ConfigDir)
 	cobra.CheckErr(err)
-
-	// Generate default config file path
-	ConfigDir = filepath.Join(home, ".kbrew")
+	ConfigDir = dir
 	if _, err := os.Stat(ConfigDir); os.IsNotExist(err) {
 		err := os.MkdirAll(ConfigDir, os.ModePerm)
 		cobra.CheckErr(err)
@@ -190,3 +214,23 @@ func InitConfig() {
 		}
 	}
 }
+
+// resolveConfigDir returns the absolute path of the config dir. The dir set with the --config-dir flag takes
+// precedence over the KBREW_HOME env var, $HOME/.kbrew is used if neither is set.
+func resolveConfigDir(dir string) (string, error) {
+	if dir == "" {
+		dir = os.Getenv(HomeEnv)
+	}
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, defaultConfigDirName)
+	}
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
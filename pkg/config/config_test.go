@@ -0,0 +1,98 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+func TestResolveConfigDir(t *testing.T) {
+	defer func(home string, ok bool) {
+		if ok {
+			os.Setenv(HomeEnv, home)
+			return
+		}
+		os.Unsetenv(HomeEnv)
+	}(os.LookupEnv(HomeEnv))
+
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		flag string
+		env  string
+		want string
+	}{
+		{want: filepath.Join(home, ".kbrew")},
+		{env: "/ci/job-1/kbrew", want: "/ci/job-1/kbrew"},
+		{flag: "/tmp/kbrew", env: "/ci/job-1/kbrew", want: "/tmp/kbrew"},
+		{flag: "~/kbrew-test", want: filepath.Join(home, "kbrew-test")},
+		{env: "kbrew-home", want: filepath.Join(wd, "kbrew-home")},
+	} {
+		os.Setenv(HomeEnv, tc.env)
+		got, err := resolveConfigDir(tc.flag)
+		if err != nil {
+			t.Errorf("flag %q env %q: unexpected error: %v", tc.flag, tc.env, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("flag %q env %q: expected %s, got %s", tc.flag, tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestNewAppOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(kubeconfig string) { os.Setenv("KUBECONFIG", kubeconfig) }(os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", filepath.Join(dir, "missing"))
+
+	recipe := `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+    type: raw
+{{- if lookup "v1" "Namespace" "" "monitoring" }}
+  namespace: monitoring
+{{- else }}
+  namespace: default
+{{- end }}
+`
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte(recipe), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewApp("app", path)
+	if err != nil {
+		t.Fatalf("failed to render recipe without cluster access: %v", err)
+	}
+	if c.App.Namespace != "default" {
+		t.Errorf("expected lookup to return empty result, got namespace %s", c.App.Namespace)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// ParseOverrides returns the recipe arg overrides passed by the user. Overrides are applied in the following order,
+// later ones taking precedence:
+//  1. values files, YAML maps of arg keys to values in the same format as the recipe args
+//  2. "key=value" pairs with the value parsed as YAML, so numbers, booleans, lists and maps keep their type
+//  3. "key=value" pairs with the value used as a string
+func ParseOverrides(set, setString, valuesFiles []string) (map[string]interface{}, error) {
+	overrides := map[string]interface{}{}
+	for _, f := range valuesFiles {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read values file %s", f)
+		}
+		vals := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &vals); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse values file %s", f)
+		}
+		for k, v := range vals {
+			overrides[k] = v
+		}
+	}
+	for _, s := range set {
+		k, v, err := splitKeyValue(s)
+		if err != nil {
+			return nil, err
+		}
+		var val interface{}
+		if err := yaml.Unmarshal([]byte(v), &val); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse value of %s", k)
+		}
+		if val == nil {
+			val = ""
+		}
+		overrides[k] = val
+	}
+	for _, s := range setString {
+		k, v, err := splitKeyValue(s)
+		if err != nil {
+			return nil, err
+		}
+		overrides[k] = v
+	}
+	return overrides, nil
+}
+
+// MergeArgs returns the recipe args with the overrides applied
+func MergeArgs(args, overrides map[string]interface{}) map[string]interface{} {
+	if len(overrides) == 0 {
+		return args
+	}
+	merged := make(map[string]interface{}, len(args)+len(overrides))
+	for k, v := range args {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Normalize converts the maps decoded from the recipe YAML with interface keys to maps with string keys,
+// so that the values can be encoded to JSON and merged with maps decoded from JSON
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprintf("%v", k)] = Normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = Normalize(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = Normalize(val)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+func splitKeyValue(s string) (string, string, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", errors.Errorf("invalid override %q, expected key=value", s)
+	}
+	return kv[0], kv[1], nil
+}
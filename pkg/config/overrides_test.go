@@ -0,0 +1,75 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseOverrides(t *testing.T) {
+	f, err := ioutil.TempFile("", "kbrew-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	values := "replicaCount: 2\nstorageClass: standard\nDeployment.nginx.spec.replicas: 4\n"
+	if _, err := f.WriteString(values); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := ParseOverrides(
+		[]string{"replicaCount=3", "persistence.enabled=true", "tolerations=[{key: dedicated}]", "empty="},
+		[]string{"image.tag=1.10", "storageClass=fast=ssd"},
+		[]string{f.Name()},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]interface{}{
+		"replicaCount":                   float64(3),
+		"storageClass":                   "fast=ssd",
+		"Deployment.nginx.spec.replicas": float64(4),
+		"persistence.enabled":            true,
+		"tolerations":                    []interface{}{map[string]interface{}{"key": "dedicated"}},
+		"empty":                          "",
+		"image.tag":                      "1.10",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseOverrides() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, invalid := range []string{"replicaCount", "=3"} {
+		if _, err := ParseOverrides([]string{invalid}, nil, nil); err == nil {
+			t.Errorf("expected error for %q, got nil", invalid)
+		}
+	}
+}
+
+func TestMergeArgs(t *testing.T) {
+	args := map[string]interface{}{"replicaCount": 1, "image.tag": "latest"}
+	got := MergeArgs(args, map[string]interface{}{"replicaCount": 3})
+	want := map[string]interface{}{"replicaCount": 3, "image.tag": "latest"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MergeArgs() mismatch (-want +got):\n%s", diff)
+	}
+	if args["replicaCount"] != 1 {
+		t.Error("MergeArgs() modified the recipe args")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// APIVersionV1 is the version of the recipe schema
+	APIVersionV1 = "v1"
+	// KindKbrew is the kind of the kbrew recipe
+	KindKbrew = "kbrew"
+)
+
+// ErrInvalidRecipe is returned when the recipe does not conform to the recipe schema
+var ErrInvalidRecipe = errors.New("invalid recipe")
+
+// Validate checks the recipe against the schema of its apiVersion and kind and returns all the violations
+func (c *AppConfig) Validate() error {
+	if c.Kind != KindKbrew {
+		return fmt.Errorf("%w: unsupported kind %q, expected %q", ErrInvalidRecipe, c.Kind, KindKbrew)
+	}
+	var msgs []string
+	switch c.APIVersion {
+	case APIVersionV1:
+		msgs = validateV1(c.App)
+	default:
+		return fmt.Errorf("%w: unsupported apiVersion %q, expected %q", ErrInvalidRecipe, c.APIVersion, APIVersionV1)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidRecipe, strings.Join(msgs, "; "))
+}
+
+func validateV1(a App) []string {
+	var msgs []string
+	switch a.Repository.Type {
+	case Helm, Raw, Kustomize:
+	case "":
+		msgs = append(msgs, "app.repository.type is required")
+	default:
+		msgs = append(msgs, fmt.Sprintf("app.repository.type %q is not one of %s, %s, %s", a.Repository.Type, Helm, Raw, Kustomize))
+	}
+	if a.Repository.URL == "" {
+		msgs = append(msgs, "app.repository.url is required")
+	}
+	if a.Repository.Type == Helm && strings.HasPrefix(a.Repository.URL, "http") && a.Repository.Name == "" {
+		msgs = append(msgs, "app.repository.name is required for helm repos")
+	}
+	// Kustomizations are built from git, the digest can not be verified
+	if a.Repository.Type == Kustomize && a.SHA256 != "" {
+		msgs = append(msgs, "app.sha256 is not supported for kustomize apps, pin the git ref of the kustomization instead")
+	}
+	msgs = append(msgs, validateArgKeys(a)...)
+	if len(a.Values) != 0 || len(a.ValuesFiles) != 0 {
+		if a.Repository.Type != Helm {
+			msgs = append(msgs, "app.values and app.values_files are supported only for helm apps")
+		}
+	}
+	if a.Namespace != "" && a.Namespace != "-" {
+		for _, m := range validation.IsDNS1123Label(a.Namespace) {
+			msgs = append(msgs, fmt.Sprintf("app.namespace %q is invalid: %s", a.Namespace, m))
+		}
+	}
+	for i, phase := range a.PreInstall {
+		msgs = append(msgs, validatePhase(fmt.Sprintf("app.pre_install[%d]", i), phase.Apps, phase.Steps)...)
+	}
+	for i, phase := range a.PostInstall {
+		msgs = append(msgs, validatePhase(fmt.Sprintf("app.post_install[%d]", i), phase.Apps, phase.Steps)...)
+	}
+	msgs = append(msgs, validatePhase("app.pre_cleanup", nil, a.PreCleanup.Steps)...)
+	msgs = append(msgs, validatePhase("app.post_cleanup", nil, a.PostCleanup.Steps)...)
+
+	for name, spec := range a.ArgsSpec {
+		field := fmt.Sprintf("app.args_spec.%s", name)
+		switch spec.Type {
+		case "", ArgString, ArgInt, ArgNumber, ArgBool, ArgList, ArgMap:
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s.type %q is not supported", field, spec.Type))
+		}
+		if spec.Pattern != "" {
+			if _, err := regexp.Compile(spec.Pattern); err != nil {
+				msgs = append(msgs, fmt.Sprintf("%s.pattern is invalid: %s", field, err.Error()))
+			}
+		}
+		if spec.Default != nil {
+			if err := validateArg(spec, spec.Default); err != nil {
+				msgs = append(msgs, fmt.Sprintf("%s.default is invalid: %s", field, err.Error()))
+			}
+		}
+	}
+	return msgs
+}
+
+// validateArgKeys checks that the args of raw and kustomize apps are in <Kind>.<Name>.<FieldPath> format
+func validateArgKeys(a App) []string {
+	if a.Repository.Type != Raw && a.Repository.Type != Kustomize {
+		return nil
+	}
+	var msgs []string
+	for k := range a.Args {
+		if len(strings.SplitN(k, ".", 3)) < 3 {
+			msgs = append(msgs, fmt.Sprintf("app.args.%s is not in <Kind>.<Name>.<FieldPath> format", k))
+		}
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+func validatePhase(field string, apps, steps []string) []string {
+	var msgs []string
+	for i, a := range apps {
+		if strings.TrimSpace(a) == "" {
+			msgs = append(msgs, fmt.Sprintf("%s.apps[%d] is empty", field, i))
+		}
+	}
+	for i, s := range steps {
+		if strings.TrimSpace(s) == "" {
+			msgs = append(msgs, fmt.Sprintf("%s.steps[%d] is empty", field, i))
+		}
+	}
+	return msgs
+}
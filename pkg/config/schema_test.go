@@ -0,0 +1,159 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewAppValidation(t *testing.T) {
+	cases := map[string]struct {
+		recipe  string
+		wantErr bool
+		errIs   error
+	}{
+		"valid recipe": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    name: bitnami
+    url: https://charts.bitnami.com/bitnami
+    type: helm
+  namespace: kafka
+  args_spec:
+    replicaCount:
+      type: int
+      default: 1
+`,
+		},
+		"unknown field": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+    type: raw
+  post_instal:
+  - steps: [echo done]
+`,
+			wantErr: true,
+		},
+		"unsupported apiVersion": {
+			recipe:  "apiVersion: v2\nkind: kbrew\n",
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"missing kind": {
+			recipe:  "apiVersion: v1\n",
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"missing repository type": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+`,
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"invalid raw args": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+    type: raw
+  args:
+    replicas: 3
+`,
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"invalid args spec": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+    type: raw
+  args_spec:
+    Deployment.nginx.spec.replicas:
+      type: integer
+      default: 3
+`,
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"kustomize sha256": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://github.com/example/kustomize//overlays/prod?ref=v1.0.0
+    type: kustomize
+  sha256: 0e8b1b4f1a3e7b5c3a1d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b
+`,
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+		"invalid namespace": {
+			recipe: `apiVersion: v1
+kind: kbrew
+app:
+  repository:
+    url: https://example.com/manifest.yaml
+    type: raw
+  namespace: Kafka_NS
+`,
+			wantErr: true,
+			errIs:   ErrInvalidRecipe,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "kbrew-recipes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "app.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.recipe), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewApp("app", path)
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if tc.errIs != nil && !errors.Is(err, tc.errIs) {
+				t.Fatalf("expected %v, got %v", tc.errIs, err)
+			}
+		})
+	}
+}
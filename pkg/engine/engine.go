@@ -63,6 +63,12 @@ func (e *Engine) Render(arg string) (string, error) {
 	return tpl.String(), nil
 }
 
+// offlineLookup is the lookup function used without cluster access, it returns empty result same as
+// the lookup function for the objects which do not exist
+func offlineLookup(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
 func (e *Engine) initFuncMap() {
 
 	includedNames := make(map[string]int)
@@ -86,6 +92,9 @@ func (e *Engine) initFuncMap() {
 
 	if e.config != nil {
 		e.fmap["lookup"] = engine.NewLookupFunction(e.config)
+	} else {
+		// Recipes are rendered without cluster access, e.g by kbrew template and lint
+		e.fmap["lookup"] = offlineLookup
 	}
 
 	e.template.Funcs(e.fmap)
@@ -67,6 +67,12 @@ func TestRender(t *testing.T) {
 				result: "SomeString",
 			},
 		},
+		"CheckOfflineLookup": {
+			arg: `{{ if lookup "v1" "Namespace" "" "kafka" }}found{{ else }}missing{{ end }}`,
+			want: want{
+				result: "missing",
+			},
+		},
 		"CheckInclude": {
 			arg: `{{define "T1"}}{{trim .}}{{end}}{{include "T1" " hello" | upper }}`,
 			want: want{
@@ -56,6 +56,13 @@ var (
 	// ECUninstallTimeout represents uninstall timeout event category
 	ECUninstallTimeout EventCategory = "uninstall-timeout"
 
+	// ECUpgradeSuccess represents upgrade success event category
+	ECUpgradeSuccess EventCategory = "upgrade-success"
+	// ECUpgradeFail represents upgrade failure event category
+	ECUpgradeFail EventCategory = "upgrade-fail"
+	// ECUpgradeTimeout represents upgrade timeout event category
+	ECUpgradeTimeout EventCategory = "upgrade-timeout"
+
 	// ECK8sEvent represents k8s events event category
 	ECK8sEvent EventCategory = "k8s-event"
 )
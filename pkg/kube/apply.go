@@ -0,0 +1,190 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// pruneKinds is the list of kinds looked up for pruning in addition to the kinds in the manifest.
+// It is the same as the default prune whitelist of kubectl apply.
+var pruneKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Endpoints"},
+	{Version: "v1", Kind: "Namespace"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Version: "v1", Kind: "PersistentVolume"},
+	{Version: "v1", Kind: "Pod"},
+	{Version: "v1", Kind: "ReplicationController"},
+	{Version: "v1", Kind: "Secret"},
+	{Version: "v1", Kind: "Service"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "batch", Version: "v1beta1", Kind: "CronJob"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+}
+
+// ApplyManifest applies all the objects in the manifest with server-side apply.
+// Apply is attempted for each object, failures are returned as an aggregated error with one entry per object.
+func (c *DynamicClient) ApplyManifest(ctx context.Context, manifest, namespace string) ([]*unstructured.Unstructured, error) {
+	objs, err := DecodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, obj := range objs {
+		if _, err := c.Apply(ctx, obj, namespace, false); err != nil {
+			errs = append(errs, errors.Wrapf(err, "Failed to apply %s", ObjectName(obj)))
+		}
+	}
+	return objs, utilerrors.NewAggregate(errs)
+}
+
+// DeleteManifest deletes all the objects in the manifest in the reverse order of their definition.
+// Objects which do not exist are ignored.
+func (c *DynamicClient) DeleteManifest(ctx context.Context, manifest, namespace string) error {
+	objs, err := DecodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := len(objs) - 1; i >= 0; i-- {
+		if err := c.Delete(ctx, objs[i], namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ManifestExists checks if any of the objects in the manifest exists.
+// Objects of the kinds not served by the cluster do not exist.
+func (c *DynamicClient) ManifestExists(ctx context.Context, manifest, namespace string) (bool, error) {
+	objs, err := DecodeManifest(manifest)
+	if err != nil {
+		return false, err
+	}
+	for _, obj := range objs {
+		_, err := c.Get(ctx, obj, namespace)
+		switch {
+		case err == nil:
+			return true, nil
+		case k8sErrors.IsNotFound(err) || meta.IsNoMatchError(errors.Cause(err)):
+		default:
+			return false, errors.Wrapf(err, "Failed to get %s", ObjectName(obj))
+		}
+	}
+	return false, nil
+}
+
+// Delete deletes the object, namespace is used if not set in the object. Missing objects are ignored.
+func (c *DynamicClient) Delete(ctx context.Context, obj *unstructured.Unstructured, namespace string) error {
+	ri, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		// Kind of the object does not exist anymore, e.g CRD deleted before the CRs
+		if meta.IsNoMatchError(errors.Cause(err)) {
+			return nil
+		}
+		return err
+	}
+	policy := metav1.DeletePropagationBackground
+	err = ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.Wrapf(err, "Failed to delete %s", ObjectName(obj))
+	}
+	return nil
+}
+
+// Prune deletes the objects matching the label selector which are not present in the applied objects.
+// Objects are looked up in the namespace of the applied objects for the kinds in the kubectl default
+// prune whitelist and the kinds of the applied objects.
+func (c *DynamicClient) Prune(ctx context.Context, applied []*unstructured.Unstructured, namespace, selector string) ([]string, error) {
+	keep := map[string]struct{}{}
+	kinds := append([]schema.GroupVersionKind{}, pruneKinds...)
+	namespaces := map[string]struct{}{}
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	namespaces[namespace] = struct{}{}
+	for _, obj := range applied {
+		keep[pruneKey(obj)] = struct{}{}
+		kinds = append(kinds, obj.GroupVersionKind())
+		if obj.GetNamespace() != "" {
+			namespaces[obj.GetNamespace()] = struct{}{}
+		}
+	}
+
+	var pruned []string
+	var errs []error
+	seen := map[schema.GroupKind]struct{}{}
+	for _, gvk := range kinds {
+		if _, ok := seen[gvk.GroupKind()]; ok {
+			continue
+		}
+		seen[gvk.GroupKind()] = struct{}{}
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			// Kind not served by the cluster
+			continue
+		}
+		lists := []*unstructured.UnstructuredList{}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			for ns := range namespaces {
+				l, err := c.dynCli.Resource(mapping.Resource).Namespace(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+				if err != nil {
+					errs = append(errs, errors.Wrapf(err, "Failed to list %s", mapping.Resource.Resource))
+					continue
+				}
+				lists = append(lists, l)
+			}
+		} else {
+			l, err := c.dynCli.Resource(mapping.Resource).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "Failed to list %s", mapping.Resource.Resource))
+				continue
+			}
+			lists = append(lists, l)
+		}
+		for _, l := range lists {
+			for i := range l.Items {
+				obj := &l.Items[i]
+				if _, ok := keep[pruneKey(obj)]; ok {
+					continue
+				}
+				if err := c.Delete(ctx, obj, obj.GetNamespace()); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				pruned = append(pruned, ObjectName(obj))
+			}
+		}
+	}
+	return pruned, utilerrors.NewAggregate(errs)
+}
+
+// pruneKey identifies the object irrespective of the API version
+func pruneKey(obj *unstructured.Unstructured) string {
+	return obj.GroupVersionKind().GroupKind().String() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
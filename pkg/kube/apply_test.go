@@ -0,0 +1,91 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const kafkaAppManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kafka-config
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: kafka-viewer
+`
+
+// labeledObject returns the object of the kafka app installed in the namespace
+func labeledObject(apiVersion, kind, namespace, name, appNamespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	if appNamespace != "" {
+		obj.SetLabels(map[string]string{"kbrew.dev/app": "kafka", "kbrew.dev/namespace": appNamespace})
+	}
+	return obj
+}
+
+func TestPrune(t *testing.T) {
+	objs := []runtime.Object{
+		labeledObject("v1", "ConfigMap", "kafka", "kafka-config", "kafka"),
+		labeledObject("v1", "ConfigMap", "kafka", "kafka-old", "kafka"),
+		labeledObject("v1", "ConfigMap", "kafka", "unrelated", ""),
+		labeledObject("v1", "ConfigMap", "other", "kafka-old", "other"),
+		labeledObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "kafka-viewer", "kafka"),
+		labeledObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "kafka-old", "kafka"),
+		labeledObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "kafka-other", "other"),
+	}
+	c, dynCli := newFakeClient(objs...)
+	// Apply returns the applied object without persisting it, the objects in the manifest exist already
+	dynCli.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		return true, obj, json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &obj.Object)
+	})
+
+	ctx := context.Background()
+	applied, err := c.ApplyManifest(ctx, kafkaAppManifest, "kafka")
+	if err != nil {
+		t.Fatalf("failed to apply manifest: %v", err)
+	}
+	pruned, err := c.Prune(ctx, applied, "kafka", "kbrew.dev/app=kafka,kbrew.dev/namespace=kafka")
+	if err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if diff := cmp.Diff([]string{"configmap/kafka/kafka-old", "clusterrole/kafka-old"}, pruned); diff != "" {
+		t.Errorf("pruned objects mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, obj := range objs {
+		obj := obj.(*unstructured.Unstructured)
+		_, err := c.Get(ctx, obj, obj.GetNamespace())
+		deleted := err != nil
+		wantDeleted := obj.GetName() == "kafka-old" && obj.GetLabels()["kbrew.dev/namespace"] == "kafka"
+		if deleted != wantDeleted {
+			t.Errorf("%s: expected deleted %v, got %v (%v)", ObjectName(obj), wantDeleted, deleted, err)
+		}
+	}
+}
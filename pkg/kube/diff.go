@@ -0,0 +1,100 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Diff compares the objects in the manifest with their live state in the cluster and writes a unified diff
+// for each object that would change on apply. The result of apply is computed with server-side dry-run.
+// Objects whose namespace or kind does not exist in the cluster yet, e.g. created by the same manifest,
+// are diffed as rendered since the dry-run can not be performed for them.
+// Returns true if any of the objects would change.
+func (c *DynamicClient) Diff(ctx context.Context, manifest, namespace string, w io.Writer) (bool, error) {
+	objs, err := DecodeManifest(manifest)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, obj := range objs {
+		live, err := c.Get(ctx, obj, namespace)
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) && !meta.IsNoMatchError(errors.Cause(err)) {
+				return changed, errors.Wrapf(err, "Failed to get %s", ObjectName(obj))
+			}
+			live = nil
+		}
+		merged, err := c.Apply(ctx, obj, namespace, true)
+		if err != nil {
+			// Apply can only fail with not found if the namespace of the object does not exist
+			if !k8sErrors.IsNotFound(err) && !meta.IsNoMatchError(errors.Cause(err)) {
+				return changed, errors.Wrapf(err, "Failed to dry-run apply %s", ObjectName(obj))
+			}
+			merged = obj
+		}
+
+		from, err := diffableYAML(live)
+		if err != nil {
+			return changed, err
+		}
+		to, err := diffableYAML(merged)
+		if err != nil {
+			return changed, err
+		}
+		if from == to {
+			continue
+		}
+		changed = true
+		name := ObjectName(obj)
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(from),
+			B:        difflib.SplitLines(to),
+			FromFile: "live/" + name,
+			ToFile:   "merged/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			return changed, errors.Wrapf(err, "Failed to compute diff for %s", name)
+		}
+		fmt.Fprint(w, diff)
+	}
+	return changed, nil
+}
+
+// diffableYAML returns YAML of the object without the fields maintained by the API server
+func diffableYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	obj.SetGeneration(0)
+	b, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to encode %s", ObjectName(obj))
+	}
+	return string(b), nil
+}
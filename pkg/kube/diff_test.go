@@ -0,0 +1,110 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const kafkaManifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: kafka
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kafka-config
+  namespace: kafka
+data:
+  replicas: "3"
+---
+apiVersion: kafka.example.com/v1
+kind: KafkaCluster
+metadata:
+  name: kafka
+  namespace: kafka
+`
+
+// newFakeClient returns DynamicClient backed by the fake discovery and dynamic clients with the objects.
+// Namespaces, config maps and cluster roles are served by the fake cluster.
+func newFakeClient(objs ...runtime.Object) (*DynamicClient, *dynamicfake.FakeDynamicClient) {
+	disc := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Verbs: metav1.Verbs{"get", "list", "patch", "delete"}},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list", "patch", "delete"}},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusterroles", Kind: "ClusterRole", Verbs: metav1.Verbs{"get", "list", "patch", "delete"}},
+			},
+		},
+	}}}
+	dynCli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "namespaces"}:                                       "NamespaceList",
+		{Version: "v1", Resource: "configmaps"}:                                       "ConfigMapList",
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}: "ClusterRoleList",
+	}, objs...)
+	return &DynamicClient{
+		dynCli: dynCli,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc)),
+	}, dynCli
+}
+
+func TestDiffNewApp(t *testing.T) {
+	c, dynCli := newFakeClient()
+	// Dry-run apply returns the applied object, or fails if the namespace does not exist
+	dynCli.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchAction)
+		if patch.GetNamespace() == "kafka" {
+			return true, nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "kafka")
+		}
+		obj := &unstructured.Unstructured{}
+		return true, obj, json.Unmarshal(patch.GetPatch(), &obj.Object)
+	})
+
+	var out bytes.Buffer
+	changed, err := c.Diff(context.Background(), kafkaManifest, "kafka", &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("expected changes for the new app")
+	}
+	for _, want := range []string{"+kind: Namespace", "+kind: ConfigMap", "+kind: KafkaCluster"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the diff, got\n%s", want, out.String())
+		}
+	}
+}
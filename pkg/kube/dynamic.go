@@ -0,0 +1,162 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	// FieldManager is the name of the field manager used by kbrew for server-side apply
+	FieldManager = "kbrew"
+
+	defaultNamespace = "default"
+)
+
+// DynamicClient operates on arbitrary K8s objects decoded from manifests
+type DynamicClient struct {
+	dynCli dynamic.Interface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// NewDynamicClient initializes and returns DynamicClient
+func NewDynamicClient() (*DynamicClient, error) {
+	kubeConfig, err := newConfig()
+	if err != nil {
+		return nil, err
+	}
+	dynCli, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create dynamic client")
+	}
+	disClient, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create discovery client")
+	}
+	return &DynamicClient{
+		dynCli: dynCli,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disClient)),
+	}, nil
+}
+
+// DecodeManifest splits yaml manifest with multiple K8s object specs and returns the list of objects.
+// Empty documents are skipped.
+func DecodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	objs := []*unstructured.Unstructured{}
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "Failed to decode manifest")
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("object kind or name missing in manifest, object: %v", obj.Object)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// ObjectName returns a human readable reference of the object
+func ObjectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", strings.ToLower(obj.GetKind()), obj.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(obj.GetKind()), obj.GetNamespace(), obj.GetName())
+}
+
+// Get returns the live state of the object, namespace is used if not set in the object
+func (c *DynamicClient) Get(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	ri, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+}
+
+// Apply creates or updates the object using server-side apply, namespace is used if not set in the object.
+// The object is not persisted if dryRun is true and the result of the apply is returned.
+func (c *DynamicClient) Apply(ctx context.Context, obj *unstructured.Unstructured, namespace string, dryRun bool) (*unstructured.Unstructured, error) {
+	ri, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encode %s", ObjectName(obj))
+	}
+	force := true
+	opts := metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return ri.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, opts)
+}
+
+// resourceFor returns the dynamic resource client for the object.
+// Namespace of the object is set to the given namespace if the object is namespaced and has no namespace set.
+func (c *DynamicClient) resourceFor(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := c.mapping(obj)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		obj.SetNamespace("")
+		return c.dynCli.Resource(mapping.Resource), nil
+	}
+	if obj.GetNamespace() == "" {
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		obj.SetNamespace(namespace)
+	}
+	return c.dynCli.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+// mapping finds the resource of the object kind. Cached discovery info is refreshed
+// if the kind is not found since CRDs might have been created after the cache was populated.
+func (c *DynamicClient) mapping(obj *unstructured.Unstructured) (*meta.RESTMapping, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find resource type of %s", ObjectName(obj))
+	}
+	return mapping, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeManifest(t *testing.T) {
+	cases := map[string]struct {
+		manifest string
+		want     []string
+		wantErr  bool
+	}{
+		"multiple documents": {
+			manifest: `# leading comment
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: kafka
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kafka-operator
+  namespace: kafka
+`,
+			want: []string{"namespace/kafka", "deployment/kafka/kafka-operator"},
+		},
+		"empty manifest": {
+			manifest: "",
+			want:     []string{},
+		},
+		"missing name": {
+			manifest: `apiVersion: v1
+kind: ConfigMap
+`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			objs, err := DecodeManifest(tc.manifest)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for _, obj := range objs {
+				got = append(got, ObjectName(obj))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("DecodeManifest() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
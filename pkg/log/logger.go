@@ -86,8 +86,7 @@ func (l *Logger) InfoMap(key, value string) {
 	l.print(fmt.Sprintf(infoMapKeyFormat, key), value)
 }
 
+// print writes the message with a single write so that messages logged concurrently are not interleaved
 func (l *Logger) print(prefix string, message ...interface{}) {
-	fmt.Fprint(l.Writer, "\r")
-	fmt.Fprint(l.Writer, prefix)
-	fmt.Fprintln(l.Writer, message...)
+	fmt.Fprint(l.Writer, "\r"+prefix+fmt.Sprintln(message...))
 }
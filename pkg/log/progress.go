@@ -0,0 +1,215 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cursorUp  = "\x1b[1A"
+	clearLine = "\x1b[2K"
+
+	successStatusFormat = " \x1b[32m✓\x1b[0m %s"
+	failureStatusFormat = " \x1b[31m✗\x1b[0m %s"
+)
+
+var (
+	defaultCharSet = []string{"⣾", "⣽", "⣻", "⢿", "⡿", "⣟", "⣯", "⣷"}
+	defaultDelay   = 100 * time.Millisecond
+)
+
+// Progress shows the status of the tasks running concurrently, one line with a spinner per task.
+// Finished tasks are printed with the success or failure mark above the running tasks.
+type Progress struct {
+	mu     sync.Mutex
+	out    io.Writer
+	logger *Logger
+	tasks  []*task
+	// lines is the number of task lines currently drawn
+	lines int
+	frame int
+	// interactive is false if the output is not a terminal, running tasks are not drawn in that case
+	interactive bool
+	stop        chan struct{}
+
+	successStatusFormat string
+	failureStatusFormat string
+}
+
+type task struct {
+	key     string
+	message string
+}
+
+// progressWriter clears the task lines before writing the messages and draws them again afterwards
+type progressWriter struct {
+	p *Progress
+}
+
+// NewProgress returns Progress drawing tasks on the writer of the logger.
+// The logger writes through Progress from then on so that its messages are printed above the running tasks.
+func NewProgress(logger *Logger) *Progress {
+	p := &Progress{
+		out:                 logger.Writer,
+		logger:              logger,
+		interactive:         isTerminal(logger.Writer),
+		successStatusFormat: successStatusFormat,
+		failureStatusFormat: failureStatusFormat,
+	}
+	logger.SetWriter(&progressWriter{p: p})
+	return p
+}
+
+// Start shows the running task identified by key, the message of the task is replaced if it is running already
+func (p *Progress) Start(key, msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t := p.find(key); t != nil {
+		t.message = msg
+	} else {
+		p.tasks = append(p.tasks, &task{key: key, message: msg})
+	}
+	if !p.interactive {
+		return
+	}
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.spin(p.stop)
+	}
+	p.redraw()
+}
+
+// Success marks the task as finished successfully. The message of the task is printed if msg is not passed.
+func (p *Progress) Success(key string, msg ...string) {
+	p.finish(key, p.successStatusFormat, msg)
+}
+
+// Error marks the task as failed. The message of the task is printed if msg is not passed.
+func (p *Progress) Error(key string, msg ...string) {
+	p.finish(key, p.failureStatusFormat, msg)
+}
+
+// Stop removes the task without printing its status
+func (p *Progress) Stop(key string) {
+	p.finish(key, "", nil)
+}
+
+func (p *Progress) finish(key, format string, msg []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := p.find(key)
+	if t == nil {
+		return
+	}
+	p.clear()
+	for i := range p.tasks {
+		if p.tasks[i] == t {
+			p.tasks = append(p.tasks[:i], p.tasks[i+1:]...)
+			break
+		}
+	}
+	if format != "" {
+		message := t.message
+		if msg != nil {
+			message = strings.Join(msg, " ")
+		}
+		fmt.Fprintf(p.out, "\r"+format+"\n", message)
+	}
+	if len(p.tasks) == 0 && p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.draw()
+}
+
+func (p *Progress) find(key string) *task {
+	for _, t := range p.tasks {
+		if t.key == key {
+			return t
+		}
+	}
+	return nil
+}
+
+// spin redraws the task lines with the next spinner frame until stop is closed
+func (p *Progress) spin(stop chan struct{}) {
+	ticker := time.NewTicker(defaultDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.redraw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *Progress) redraw() {
+	p.clear()
+	p.draw()
+}
+
+// clear erases the task lines and moves the cursor to the beginning of the first one
+func (p *Progress) clear() {
+	if p.lines == 0 {
+		return
+	}
+	fmt.Fprint(p.out, "\r"+strings.Repeat(cursorUp+clearLine, p.lines))
+	p.lines = 0
+}
+
+func (p *Progress) draw() {
+	if !p.interactive {
+		return
+	}
+	var b strings.Builder
+	for _, t := range p.tasks {
+		fmt.Fprintf(&b, "%s%s %s \n", clearLine, defaultCharSet[p.frame%len(defaultCharSet)], t.message)
+	}
+	fmt.Fprint(p.out, b.String())
+	p.lines = len(p.tasks)
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	w.p.clear()
+	n, err := w.p.out.Write(b)
+	w.p.draw()
+	return n, err
+}
+
+// isTerminal checks if the writer is a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProgressTestSuite struct{}
+
+var _ = Suite(&ProgressTestSuite{})
+
+func (s *ProgressTestSuite) TestProgress(c *C) {
+	var buf bytes.Buffer
+	log := NewLogger(false)
+	log.SetWriter(&buf)
+	p := NewProgress(log)
+
+	p.Start("app1", "Installing app1")
+	p.Start("app2", "Installing app2")
+	log.Info("waiting for app1")
+	p.Start("app1", "Setting up post-install dependencies for app1")
+	p.Success("app2")
+	p.Error("app1", "app1 installation failed")
+	p.Stop("app1")
+	p.Success("app3")
+	c.Assert(buf.String(), Equals, "\rwaiting for app1\n"+
+		"\r \x1b[32m✓\x1b[0m Installing app2\n"+
+		"\r \x1b[31m✗\x1b[0m app1 installation failed\n")
+
+	// Running tasks are redrawn around the log messages on terminals
+	buf.Reset()
+	p.interactive = true
+	// Spinner is not started so that the output does not depend on timing
+	p.stop = make(chan struct{})
+	p.Start("app1", "Installing app1")
+	log.Info("waiting for app1")
+	p.Success("app1")
+	c.Assert(buf.String(), Equals, "\x1b[2K⣾ Installing app1 \n"+
+		"\r\x1b[1A\x1b[2K\rwaiting for app1\n\x1b[2K⣾ Installing app1 \n"+
+		"\r\x1b[1A\x1b[2K\r \x1b[32m✓\x1b[0m Installing app1\n")
+}
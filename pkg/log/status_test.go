@@ -1,43 +0,0 @@
-// Copyright 2021 The kbrew Authors.
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-//      http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package log
-
-import (
-	"testing"
-	"time"
-)
-
-func TestSuccessMessage(t *testing.T) {
-	l := NewLogger(true)
-	s := NewStatus(l)
-	l.Info("Initializing")
-	s.Start("Setting up deps")
-	time.Sleep(2 * time.Second)
-	l.Debug("Waiting for pods to be ready!!")
-	time.Sleep(time.Second)
-	s.Stop()
-	s.Start("Installing app2")
-	time.Sleep(2 * time.Second)
-	s.Success("Install successful", "app=app2")
-	s.Start("Setting up post install deps")
-	time.Sleep(2 * time.Second)
-	s.Start("Installing app3")
-	time.Sleep(2 * time.Second)
-	s.Success()
-	s.Start("Installing app4")
-	time.Sleep(2 * time.Second)
-	l.Error("Timed out while waiting for pods to be ready!!")
-	s.Error("App4 Installation failed!")
-}
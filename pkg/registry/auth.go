@@ -0,0 +1,179 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+const (
+	// GitTokenEnv is the env var holding the token used to access the registries over https
+	GitTokenEnv = "KBREW_GIT_TOKEN"
+	// GitTokenHostEnv is the env var holding the git host the token is sent to
+	GitTokenHostEnv = "KBREW_GIT_TOKEN_HOST"
+	// GitUsernameEnv is the env var holding the username sent along with the token
+	GitUsernameEnv = "KBREW_GIT_USERNAME"
+	// SSHKeyEnv is the env var holding the path of the private key used to access the registries over ssh
+	SSHKeyEnv = "KBREW_SSH_KEY"
+
+	// tokenUsername is sent with the token if the username is not set, git hosts accept any username with a token
+	tokenUsername = "kbrew"
+	sshUsername   = "git"
+
+	credentialHelperTimeout = 30 * time.Second
+)
+
+// defaultSSHKeys are the private keys looked up in the ~/.ssh dir if no ssh agent is running
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// authMethod returns the auth method used to clone and fetch the registry from the git URL. Nil is returned
+// for anonymous access. For https, credentials are looked up in the kbrew config, the KBREW_GIT_TOKEN env var if
+// KBREW_GIT_TOKEN_HOST matches the host and the git credential helpers. For ssh, the key is looked up in the kbrew config, the KBREW_SSH_KEY env var,
+// the ssh agent and the default keys in ~/.ssh.
+func authMethod(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid registry URL %s", url)
+	}
+	hostAuth, err := configAuth(ep.Host)
+	if err != nil {
+		return nil, err
+	}
+	switch ep.Protocol {
+	case "http", "https":
+		return httpAuth(ep, hostAuth), nil
+	case "ssh":
+		return sshAuth(ep, hostAuth)
+	default:
+		return nil, nil
+	}
+}
+
+// configAuth returns the credentials for the host set in the kbrew config
+func configAuth(host string) (config.RegistryAuth, error) {
+	kc, err := config.NewKbrew()
+	if err != nil {
+		return config.RegistryAuth{}, err
+	}
+	for _, a := range kc.RegistryAuth {
+		if strings.EqualFold(a.Host, host) {
+			return a, nil
+		}
+	}
+	return config.RegistryAuth{}, nil
+}
+
+func httpAuth(ep *transport.Endpoint, hostAuth config.RegistryAuth) transport.AuthMethod {
+	if hostAuth.Token != "" {
+		return &http.BasicAuth{Username: orDefault(hostAuth.Username, tokenUsername), Password: hostAuth.Token}
+	}
+	// The token is never sent to the hosts other than the one it is meant for
+	if token := os.Getenv(GitTokenEnv); token != "" && strings.EqualFold(os.Getenv(GitTokenHostEnv), ep.Host) {
+		return &http.BasicAuth{Username: orDefault(os.Getenv(GitUsernameEnv), tokenUsername), Password: token}
+	}
+	if ep.User != "" && ep.Password != "" {
+		return &http.BasicAuth{Username: ep.User, Password: ep.Password}
+	}
+	if username, password, ok := gitCredential(ep); ok {
+		return &http.BasicAuth{Username: username, Password: password}
+	}
+	return nil
+}
+
+func sshAuth(ep *transport.Endpoint, hostAuth config.RegistryAuth) (transport.AuthMethod, error) {
+	user := orDefault(ep.User, orDefault(hostAuth.Username, sshUsername))
+	key := orDefault(hostAuth.SSHKey, os.Getenv(SSHKeyEnv))
+	if key != "" {
+		path, err := homedir.Expand(key)
+		if err != nil {
+			return nil, err
+		}
+		auth, err := ssh.NewPublicKeysFromFile(user, path, "")
+		return auth, errors.Wrapf(err, "failed to read ssh key %s", path)
+	}
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		auth, err := ssh.NewSSHAgentAuth(user)
+		return auth, errors.Wrap(err, "failed to connect to ssh agent")
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range defaultSSHKeys {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		auth, err := ssh.NewPublicKeysFromFile(user, path, "")
+		return auth, errors.Wrapf(err, "failed to read ssh key %s", path)
+	}
+	return nil, nil
+}
+
+// gitCredential asks the git credential helpers configured for the user for the credentials of the endpoint.
+// Git does not prompt for the credentials if no helper provides them.
+func gitCredential(ep *transport.Endpoint) (string, string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	host := ep.Host
+	if ep.Port != 0 {
+		host = fmt.Sprintf("%s:%d", ep.Host, ep.Port)
+	}
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", ep.Protocol, host, strings.TrimPrefix(ep.Path, "/")))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", false
+	}
+	var username, password string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "username":
+			username = kv[1]
+		case "password":
+			password = kv[1]
+		}
+	}
+	return username, password, password != ""
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
+)
+
+// setEnv sets the env vars and returns the func restoring them
+func setEnv(env map[string]string) func() {
+	old := map[string]*string{}
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+				continue
+			}
+			os.Setenv(k, *v)
+		}
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	// Credential helper returning the same credentials for every host
+	defer setEnv(map[string]string{
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "credential.helper",
+		"GIT_CONFIG_VALUE_0": "!f() { echo username=helper; echo password=helper-secret; }; f",
+		GitTokenEnv:          "",
+		GitTokenHostEnv:      "",
+		GitUsernameEnv:       "",
+	})()
+	viper.Set("registryAuth", []map[string]interface{}{
+		{"host": "gitlab.example.com", "username": "deploy", "token": "config-secret"},
+	})
+	defer viper.Set("registryAuth", nil)
+
+	for _, tc := range []struct {
+		url  string
+		env  map[string]string
+		want transport.AuthMethod
+	}{
+		{
+			url:  "https://git.example.com/platform/recipes.git",
+			env:  map[string]string{GitTokenEnv: "env-secret", GitTokenHostEnv: "git.example.com"},
+			want: &http.BasicAuth{Username: tokenUsername, Password: "env-secret"},
+		},
+		{
+			url:  "https://git.example.com/platform/recipes.git",
+			env:  map[string]string{GitTokenEnv: "env-secret", GitTokenHostEnv: "git.example.com", GitUsernameEnv: "ci"},
+			want: &http.BasicAuth{Username: "ci", Password: "env-secret"},
+		},
+		{
+			// Token for git.example.com is not sent to github.com
+			url:  "https://github.com/kbrew-dev/kbrew-registry.git",
+			env:  map[string]string{GitTokenEnv: "env-secret", GitTokenHostEnv: "git.example.com"},
+			want: &http.BasicAuth{Username: "helper", Password: "helper-secret"},
+		},
+		{
+			// Token is not sent anywhere without the host
+			url:  "https://git.example.com/platform/recipes.git",
+			env:  map[string]string{GitTokenEnv: "env-secret"},
+			want: &http.BasicAuth{Username: "helper", Password: "helper-secret"},
+		},
+		{
+			// Host config takes precedence over the env token
+			url:  "https://gitlab.example.com/platform/recipes.git",
+			env:  map[string]string{GitTokenEnv: "env-secret", GitTokenHostEnv: "gitlab.example.com"},
+			want: &http.BasicAuth{Username: "deploy", Password: "config-secret"},
+		},
+		{
+			url:  "https://gitlab.example.com/platform/recipes.git",
+			want: &http.BasicAuth{Username: "deploy", Password: "config-secret"},
+		},
+		{
+			url:  "https://github.com/acme/recipes.git",
+			want: &http.BasicAuth{Username: "helper", Password: "helper-secret"},
+		},
+		{
+			url: "file:///srv/git/acme/recipes",
+		},
+	} {
+		restore := setEnv(tc.env)
+		got, err := authMethod(tc.url)
+		restore()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.url, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: auth mismatch (-want +got):\n%s", tc.url, diff)
+		}
+	}
+}
+
+func TestSSHAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_rsa")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(map[string]string{SSHKeyEnv: keyPath})()
+
+	for url, user := range map[string]string{
+		"git@gitlab.example.com:platform/recipes.git":  "git",
+		"ssh://deploy@gitea.local:2222/team/kbrew.git": "deploy",
+	} {
+		auth, err := authMethod(url)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", url, err)
+		}
+		keys, ok := auth.(*ssh.PublicKeys)
+		if !ok {
+			t.Fatalf("%s: expected ssh public keys auth, got %T", url, auth)
+		}
+		if keys.User != user {
+			t.Errorf("%s: expected user %s, got %s", url, user, keys.User)
+		}
+	}
+
+	defer setEnv(map[string]string{SSHKeyEnv: filepath.Join(dir, "missing")})()
+	if _, err := authMethod("git@gitlab.example.com:platform/recipes.git"); err == nil {
+		t.Error("expected error for missing ssh key")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// indexFileName is the file within the registries dir holding the registries metadata
+const indexFileName = "index.yaml"
+
+// index holds the metadata of the registries which is not recorded in their git repos
+type index struct {
+	Registries map[string]registryMeta `yaml:"registries"`
+}
+
+// registryMeta is the source of a registry. Ref pins the registry to a branch, tag or commit,
+// the default branch of the repo is tracked if it is not set.
+type registryMeta struct {
+	URL string `yaml:"url"`
+	Ref string `yaml:"ref,omitempty"`
+}
+
+// loadIndex reads the registries index, an empty index is returned if the file does not exist
+func loadIndex(dir string) (*index, error) {
+	idx := &index{Registries: map[string]registryMeta{}}
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+		return nil, errors.Wrap(err, "failed to read registries index")
+	}
+	if err := yaml.Unmarshal(data, idx); err != nil {
+		return nil, errors.Wrap(err, "failed to decode registries index")
+	}
+	if idx.Registries == nil {
+		idx.Registries = map[string]registryMeta{}
+	}
+	return idx, nil
+}
+
+// save writes the registries index to the dir
+func (idx *index) save(dir string) error {
+	data, err := yaml.Marshal(idx)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode registries index")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create registries dir %s", dir)
+	}
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(dir, indexFileName), data, 0644), "failed to write registries index")
+}
+
+// resolveRef returns the commit the ref points to. Branches are resolved from the remote so that
+// fetched updates are picked up, tags and commit hashes are resolved as is.
+func resolveRef(r *git.Repository, ref string) (*plumbing.Hash, error) {
+	for _, rev := range []string{plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref).String(), ref} {
+		if h, err := r.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			return h, nil
+		}
+	}
+	return nil, errors.Errorf("failed to find branch, tag or commit %s", ref)
+}
+
+// checkoutRef checks out the commit the ref points to, leaving the worktree at detached HEAD
+func checkoutRef(r *git.Repository, ref string) error {
+	h, err := resolveRef(r, ref)
+	if err != nil {
+		return err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(wt.Checkout(&git.CheckoutOptions{Hash: *h, Force: true}), "failed to checkout %s", ref)
+}
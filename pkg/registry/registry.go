@@ -21,12 +21,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
 	"github.com/kbrew-dev/kbrew/pkg/config"
@@ -38,11 +37,22 @@ const (
 	defaultRegistryUserName = "kbrew-dev"
 	defaultRegistryRepoName = "kbrew-registry"
 	ghRegistryURLFormat     = "https://github.com/%s/%s.git"
-	kbrewDir                = ".kbrew"
 )
 
-// recipeFilenamePattern regex pattern to search recipe files within a registry
-var recipeFilenamePattern = regexp.MustCompile(`(?m)recipes\/(.*)\.yaml`)
+var (
+	// recipeFilenamePattern regex pattern to search recipe files within a registry, matched against the path
+	// relative to the registry dir
+	recipeFilenamePattern = regexp.MustCompile(`^recipes\/(.*)\.yaml$`)
+	// ghRepoPattern matches GitHub USER/REPO registry source
+	ghRepoPattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+	// defaultRegistrySource is the source of the registry added when the config dir has no default registry
+	defaultRegistrySource = fmt.Sprintf("%s/%s", defaultRegistryUserName, defaultRegistryRepoName)
+
+	// ErrRegistryNotFound is returned when the registry is not added to the config dir
+	ErrRegistryNotFound = errors.New("registry not found")
+	// ErrRegistryExists is returned when adding a registry which is added already
+	ErrRegistryExists = errors.New("registry already exists")
+)
 
 // KbrewRegistry is the collection of kbrew recipes
 type KbrewRegistry struct {
@@ -53,49 +63,214 @@ type KbrewRegistry struct {
 type Info struct {
 	Name string
 	Path string
+	// Registry is the name of the registry holding the recipe
+	Registry string
+}
+
+// QualifiedName returns the app name qualified with the registry name, e.g USER/REPO/APP
+func (i Info) QualifiedName() string {
+	return fmt.Sprintf("%s/%s", i.Registry, i.Name)
+}
+
+// Registry holds the details of a registry added to the config dir
+type Registry struct {
+	// Name of the registry in the USER/REPO format
+	Name string
+	URL  string
+	// Ref is the branch, tag or commit the registry is pinned to
+	Ref     string
+	Path    string
+	Head    string
+	Recipes int
 }
 
 // New initializes KbrewRegistry, creates or clones default registry if not exists
 func New(configDir string) (*KbrewRegistry, error) {
 	r := &KbrewRegistry{
-		path: filepath.Join(configDir),
+		path: filepath.Join(configDir, registriesDirName),
 	}
 	return r, r.init()
 }
 
-// init creates config dir and clones default registry if not exists
+// init clones default registry if not exists
 func (kr *KbrewRegistry) init() error {
-	home, err := homedir.Dir()
-	cobra.CheckErr(err)
-
-	registriesDir := filepath.Join(home, kbrewDir, registriesDirName)
-
 	// Check if default kbrew-registry exists, clone if not added already
-	if _, err := os.Stat(filepath.Join(registriesDir, defaultRegistryUserName, defaultRegistryRepoName)); os.IsNotExist(err) {
-		return kr.Add(defaultRegistryUserName, defaultRegistryRepoName, registriesDir)
+	if _, err := os.Stat(filepath.Join(kr.path, defaultRegistryUserName, defaultRegistryRepoName)); os.IsNotExist(err) {
+		_, err := kr.Add(defaultRegistrySource, "")
+		return err
 	}
 	return nil
 }
 
-// Add clones given kbrew registry in the config dir
-func (kr *KbrewRegistry) Add(user, repo, path string) error {
-	fmt.Printf("Adding %s/%s registry to %s\n", user, repo, path)
-	r, err := git.PlainClone(filepath.Join(path, user, repo), false, &git.CloneOptions{
-		URL:               fmt.Sprintf(ghRegistryURLFormat, user, repo),
+// Add clones the kbrew registry in the config dir and returns the name of the registry.
+// Source is either GitHub USER/REPO or URL of the git repo. If ref is set, the registry is pinned to the branch,
+// tag or commit, otherwise it tracks the default branch of the repo.
+func (kr *KbrewRegistry) Add(source, ref string) (string, error) {
+	name, url, err := parseSource(source)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(kr.path, name)
+	if _, err := os.Stat(dir); err == nil {
+		return "", errors.Wrap(ErrRegistryExists, name)
+	}
+	auth, err := authMethod(url)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Adding %s registry to %s\n", name, kr.path)
+	r, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:               url,
+		Auth:              auth,
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 	})
 	if err != nil {
-		return err
+		// Do not leave partially cloned registry behind
+		os.RemoveAll(dir)
+		return "", errors.Wrapf(err, "failed to clone registry %s", url)
+	}
+	if ref != "" {
+		if err := checkoutRef(r, ref); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrapf(err, "failed to pin registry %s", name)
+		}
+	}
+	if err := kr.setMeta(name, &registryMeta{URL: url, Ref: ref}); err != nil {
+		return "", err
 	}
 	head, err := r.Head()
 	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Registry %s head at %s\n", name, head.Hash())
+	return name, nil
+}
+
+// setMeta records the metadata of the registry in the registries index, the entry is removed if meta is nil
+func (kr *KbrewRegistry) setMeta(name string, meta *registryMeta) error {
+	idx, err := loadIndex(kr.path)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		delete(idx.Registries, name)
+	} else {
+		idx.Registries[name] = *meta
+	}
+	return idx.save(kr.path)
+}
+
+// meta returns the metadata of the registry, registries cloned by hand do not have metadata
+func (kr *KbrewRegistry) meta(name string) (registryMeta, error) {
+	idx, err := loadIndex(kr.path)
+	if err != nil {
+		return registryMeta{}, err
+	}
+	return idx.Registries[name], nil
+}
+
+// Remove deletes the registry from the config dir. The default registry can not be removed.
+func (kr *KbrewRegistry) Remove(name string) error {
+	if name == fmt.Sprintf("%s/%s", defaultRegistryUserName, defaultRegistryRepoName) {
+		return fmt.Errorf("default registry %s can not be removed", name)
+	}
+	if !validName(name) {
+		return errors.Wrap(ErrRegistryNotFound, name)
+	}
+	dir := filepath.Join(kr.path, name)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return errors.Wrap(ErrRegistryNotFound, name)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "failed to remove registry %s", name)
+	}
+	if err := kr.setMeta(name, nil); err != nil {
 		return err
 	}
-	fmt.Printf("Registry %s/%s head at %s\n", user, repo, head)
-	return err
+	// Remove the USER dir if it holds no other registries
+	userDir := filepath.Dir(dir)
+	if entries, err := ioutil.ReadDir(userDir); err == nil && len(entries) == 0 {
+		return os.Remove(userDir)
+	}
+	return nil
+}
+
+// Get returns the details of the registry
+func (kr *KbrewRegistry) Get(name string) (*Registry, error) {
+	if !validName(name) {
+		return nil, errors.Wrap(ErrRegistryNotFound, name)
+	}
+	dir := filepath.Join(kr.path, name)
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		if err == git.ErrRepositoryNotExists {
+			return nil, errors.Wrap(ErrRegistryNotFound, name)
+		}
+		return nil, errors.Wrapf(err, "failed to open registry %s", name)
+	}
+	meta, err := kr.meta(name)
+	if err != nil {
+		return nil, err
+	}
+	reg := &Registry{Name: name, Path: dir, URL: meta.URL, Ref: meta.Ref}
+	if remote, err := r.Remote(git.DefaultRemoteName); err == nil && len(remote.Config().URLs) != 0 {
+		reg.URL = remote.Config().URLs[0]
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find head of registry %s", name)
+	}
+	reg.Head = head.Hash().String()
+	recipes, err := listRecipes(dir)
+	if err != nil {
+		return nil, err
+	}
+	reg.Recipes = len(recipes)
+	return reg, nil
+}
+
+// validName checks if the registry name is in the USER/REPO format
+func validName(name string) bool {
+	if !ghRepoPattern.MatchString(name) {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
 }
 
-// FetchRecipe iterates over all the kbrew recipes and returns path of the app recipe file
+// parseSource returns the name and the git URL of the registry source. Source is either GitHub USER/REPO
+// or URL of the git repo, in which case the name is made of the last two elements of the URL path.
+func parseSource(source string) (string, string, error) {
+	if validName(source) {
+		parts := strings.Split(source, "/")
+		return source, fmt.Sprintf(ghRegistryURLFormat, parts[0], parts[1]), nil
+	}
+	path := source
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+len("://"):]
+	} else if i := strings.Index(path, ":"); i >= 0 {
+		// scp-like ssh URL, e.g git@gitlab.com:org/repo.git
+		path = path[i+1:]
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("invalid registry %s, expected GitHub USER/REPO or git URL", source)
+	}
+	name := fmt.Sprintf("%s/%s", parts[len(parts)-2], parts[len(parts)-1])
+	if !validName(name) {
+		return "", "", fmt.Errorf("invalid registry %s, expected GitHub USER/REPO or git URL", source)
+	}
+	return name, source, nil
+}
+
+// FetchRecipe returns path of the app recipe file. If multiple registries have the recipe, the one from the registry
+// with the highest priority is returned. App name qualified with the registry, e.g USER/REPO/APP, is looked up only
+// in that registry.
 func (kr *KbrewRegistry) FetchRecipe(appName string) (string, error) {
 	// Iterate over all the registries
 	info, err := kr.Search(appName, true)
@@ -108,14 +283,19 @@ func (kr *KbrewRegistry) FetchRecipe(appName string) (string, error) {
 	return info[0].Path, nil
 }
 
-// Search returns app Info for give app
+// Search returns app Info for give app ordered by the registry priority.
+// Without exactMatch, recipes with the same name from multiple registries are all returned.
 func (kr *KbrewRegistry) Search(appName string, exactMatch bool) ([]Info, error) {
 	result := []Info{}
 	appList, err := kr.ListApps()
 	if err != nil {
 		return nil, err
 	}
+	registry, appName := splitName(appName)
 	for _, app := range appList {
+		if registry != "" && app.Registry != registry {
+			continue
+		}
 		if exactMatch {
 			if app.Name == appName {
 				return []Info{app}, nil
@@ -129,10 +309,54 @@ func (kr *KbrewRegistry) Search(appName string, exactMatch bool) ([]Info, error)
 	return result, nil
 }
 
-// ListApps return Info list of all the apps
+// ListApps return Info list of all the apps ordered by the registry priority and the app name
 func (kr *KbrewRegistry) ListApps() ([]Info, error) {
+	registries, err := kr.List()
+	if err != nil {
+		return nil, err
+	}
+	infoList := []Info{}
+	for _, r := range registries {
+		recipes, err := listRecipes(filepath.Join(kr.path, r))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(recipes, func(i, j int) bool { return recipes[i].Name < recipes[j].Name })
+		for i := range recipes {
+			recipes[i].Registry = r
+		}
+		infoList = append(infoList, recipes...)
+	}
+	return infoList, nil
+}
+
+// Lookup returns path of the app recipe file from the registries in the config dir, without cloning
+// the default registry
+func Lookup(configDir, appName string) (string, error) {
+	kr := &KbrewRegistry{path: filepath.Join(configDir, registriesDirName)}
+	return kr.FetchRecipe(appName)
+}
+
+// AppName returns the name of the app without the registry, e.g APP for USER/REPO/APP
+func AppName(name string) string {
+	_, appName := splitName(name)
+	return appName
+}
+
+// splitName returns the registry and the app name of the name qualified with the registry.
+// Registry is empty if the name is not qualified.
+func splitName(name string) (string, string) {
+	if strings.Count(name, "/") < 2 {
+		return "", name
+	}
+	i := strings.LastIndex(name, "/")
+	return name[:i], name[i+1:]
+}
+
+// listRecipes returns Info list of the recipes in the dir
+func listRecipes(dir string) ([]Info, error) {
 	infoList := []Info{}
-	err := filepath.WalkDir(kr.path, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -143,7 +367,11 @@ func (kr *KbrewRegistry) ListApps() ([]Info, error) {
 		if d.IsDir() {
 			return nil
 		}
-		for _, match := range recipeFilenamePattern.FindAllStringSubmatch(path, -1) {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		for _, match := range recipeFilenamePattern.FindAllStringSubmatch(filepath.ToSlash(rel), -1) {
 			if len(match) != 2 {
 				continue
 			}
@@ -154,14 +382,18 @@ func (kr *KbrewRegistry) ListApps() ([]Info, error) {
 	return infoList, err
 }
 
-// List returns list of registries
+// List returns list of registries in the priority order. Registries listed in the registryPriority of the kbrew
+// config come first in the same order, followed by the other registries sorted by name, the default registry is last.
 func (kr *KbrewRegistry) List() ([]string, error) {
 	registries := []string{}
 
-	// Registries are placed at - CONFIG_DIR/GITHUB_USER/GITHUB_REPO path
+	// Registries are placed at - REGISTRIES_DIR/GITHUB_USER/GITHUB_REPO path
 	// Interate over all the GITHUB_USERS dirs to find the list of all kbrew registries
 	dirs, err := ioutil.ReadDir(kr.path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return registries, nil
+		}
 		return nil, err
 	}
 	for _, user := range dirs {
@@ -179,7 +411,34 @@ func (kr *KbrewRegistry) List() ([]string, error) {
 			registries = append(registries, fmt.Sprintf("%s/%s", user.Name(), repo.Name()))
 		}
 	}
-	return registries, nil
+	kc, err := config.NewKbrew()
+	if err != nil {
+		return nil, err
+	}
+	return sortByPriority(registries, kc.RegistryPriority), nil
+}
+
+// sortByPriority orders the registries by the priority list
+func sortByPriority(registries, priority []string) []string {
+	rank := func(name string) int {
+		for i, p := range priority {
+			if p == name {
+				return i
+			}
+		}
+		if name == fmt.Sprintf("%s/%s", defaultRegistryUserName, defaultRegistryRepoName) {
+			return len(priority) + 1
+		}
+		return len(priority)
+	}
+	sort.SliceStable(registries, func(i, j int) bool {
+		ri, rj := rank(registries[i]), rank(registries[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return registries[i] < registries[j]
+	})
+	return registries
 }
 
 // Update pull latest commits from registry repos
@@ -189,7 +448,11 @@ func (kr *KbrewRegistry) Update() error {
 		return err
 	}
 	for _, r := range registries {
-		if err := fetchUpdates(kr.path, r); err != nil {
+		meta, err := kr.meta(r)
+		if err != nil {
+			return err
+		}
+		if err := fetchUpdates(kr.path, r, meta.Ref); err != nil {
 			return err
 		}
 	}
@@ -202,7 +465,7 @@ func (kr *KbrewRegistry) Info(appName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	a, err := config.NewApp(appName, c)
+	a, err := config.NewApp(AppName(appName), c)
 	if err != nil {
 		return "", err
 	}
@@ -213,21 +476,42 @@ func (kr *KbrewRegistry) Info(appName string) (string, error) {
 	return string(bytes), nil
 }
 
-// Args returns the arguments declared for a recipe
-func (kr *KbrewRegistry) Args(appName string) (map[string]interface{}, error) {
+// Args returns the recipe of the app with the arguments and the arguments spec declared in it
+func (kr *KbrewRegistry) Args(appName string) (*config.App, error) {
 	c, err := kr.FetchRecipe(appName)
 	if err != nil {
 		return nil, err
 	}
-	a, err := config.NewApp(appName, c)
+	a, err := config.NewApp(AppName(appName), c)
 	if err != nil {
 		return nil, err
 	}
 
-	return a.App.Args, nil
+	return &a.App, nil
+}
+
+// RecipeSource returns the registry name and the HEAD commit of the registry holding the recipe file
+func RecipeSource(recipePath string) (string, string, error) {
+	r, err := git.PlainOpenWithOptions(filepath.Dir(recipePath), &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to find registry for recipe %s", recipePath)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to find registry for recipe %s", recipePath)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to find head of registry for recipe %s", recipePath)
+	}
+	// Registries are placed at - REGISTRIES_DIR/GITHUB_USER/GITHUB_REPO path
+	root := wt.Filesystem.Root()
+	return fmt.Sprintf("%s/%s", filepath.Base(filepath.Dir(root)), filepath.Base(root)), head.Hash().String(), nil
 }
 
-func fetchUpdates(rootDir, repo string) error {
+// fetchUpdates pulls the latest commits of the registry. Registry pinned to a ref is moved to the commit
+// the ref points to after fetching, which changes only if the ref is a branch.
+func fetchUpdates(rootDir, repo, ref string) error {
 	gitRegistry, err := git.PlainOpen(filepath.Join(rootDir, repo))
 	if err != nil {
 		if err == git.ErrRepositoryNotExists {
@@ -240,9 +524,27 @@ func fetchUpdates(rootDir, repo string) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to fetch updates for %s repo", repo)
 	}
-	err = wt.Pull(&git.PullOptions{})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return errors.Wrapf(err, "failed to fetch updates for %s repo", repo)
+	remote, err := gitRegistry.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find remote of %s repo", repo)
+	}
+	auth, err := authMethod(remote.Config().URLs[0])
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		err = gitRegistry.Fetch(&git.FetchOptions{Auth: auth, Tags: git.AllTags, Force: true})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return errors.Wrapf(err, "failed to fetch updates for %s repo", repo)
+		}
+		if err := checkoutRef(gitRegistry, ref); err != nil {
+			return errors.Wrapf(err, "failed to update %s repo", repo)
+		}
+	} else {
+		err = wt.Pull(&git.PullOptions{Auth: auth})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return errors.Wrapf(err, "failed to fetch updates for %s repo", repo)
+		}
 	}
 	head, err := gitRegistry.Head()
 	if err != nil {
@@ -0,0 +1,351 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+func TestParseSource(t *testing.T) {
+	for _, tc := range []struct {
+		source  string
+		name    string
+		url     string
+		invalid bool
+	}{
+		{source: "kbrew-dev/kbrew-registry", name: "kbrew-dev/kbrew-registry", url: "https://github.com/kbrew-dev/kbrew-registry.git"},
+		{source: "https://gitlab.example.com/platform/recipes.git", name: "platform/recipes", url: "https://gitlab.example.com/platform/recipes.git"},
+		{source: "git@gitlab.example.com:platform/recipes.git", name: "platform/recipes", url: "git@gitlab.example.com:platform/recipes.git"},
+		{source: "ssh://git@gitea.local:2222/team/kbrew/", name: "team/kbrew", url: "ssh://git@gitea.local:2222/team/kbrew/"},
+		{source: "file:///srv/git/acme/registry", name: "acme/registry", url: "file:///srv/git/acme/registry"},
+		{source: "recipes", invalid: true},
+		{source: "https://example.com/../..", invalid: true},
+	} {
+		name, url, err := parseSource(tc.source)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected error, got name %s", tc.source, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.source, err)
+			continue
+		}
+		if name != tc.name || url != tc.url {
+			t.Errorf("%s: got name %s url %s, want name %s url %s", tc.source, name, url, tc.name, tc.url)
+		}
+	}
+}
+
+// newGitRepo creates a git repo with the recipes committed at dir/owner/repo
+func newGitRepo(t *testing.T, dir string, recipes ...string) string {
+	path := filepath.Join(dir, "owner", "repo")
+	if _, err := git.PlainInit(path, false); err != nil {
+		t.Fatal(err)
+	}
+	commitRecipes(t, path, recipes...)
+	return path
+}
+
+// commitRecipes adds the recipes to the git repo at path and returns the commit hash
+func commitRecipes(t *testing.T, path string, recipes ...string) plumbing.Hash {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "recipes"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range recipes {
+		if err := ioutil.WriteFile(filepath.Join(path, "recipes", name+".yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := wt.Add("recipes"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "kbrew", Email: "kbrew@example.com", When: time.Now()}
+	h, err := wt.Commit("Add recipes", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestManageRegistries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := newGitRepo(t, filepath.Join(dir, "src"), "postgres", "redis")
+	kr := &KbrewRegistry{path: filepath.Join(dir, registriesDirName)}
+
+	name, err := kr.Add(src, "")
+	if err != nil {
+		t.Fatalf("failed to add registry: %v", err)
+	}
+	if name != "owner/repo" {
+		t.Errorf("unexpected registry name %s", name)
+	}
+	if _, err := kr.Add(src, ""); !errors.Is(err, ErrRegistryExists) {
+		t.Errorf("expected registry exists error, got %v", err)
+	}
+
+	list, err := kr.List()
+	if err != nil {
+		t.Fatalf("failed to list registries: %v", err)
+	}
+	if diff := cmp.Diff([]string{"owner/repo"}, list); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+	reg, err := kr.Get("owner/repo")
+	if err != nil {
+		t.Fatalf("failed to get registry: %v", err)
+	}
+	if reg.URL != src || reg.Recipes != 2 || len(reg.Head) != 40 {
+		t.Errorf("unexpected registry details %+v", reg)
+	}
+	if _, err := kr.FetchRecipe("redis"); err != nil {
+		t.Errorf("failed to fetch recipe from the added registry: %v", err)
+	}
+
+	if err := kr.Remove("owner/repo"); err != nil {
+		t.Fatalf("failed to remove registry: %v", err)
+	}
+	if _, err := kr.Get("owner/repo"); !errors.Is(err, ErrRegistryNotFound) {
+		t.Errorf("expected registry not found error after remove, got %v", err)
+	}
+	if err := kr.Remove("owner/repo"); !errors.Is(err, ErrRegistryNotFound) {
+		t.Errorf("expected registry not found error, got %v", err)
+	}
+	if err := kr.Remove("kbrew-dev/kbrew-registry"); err == nil {
+		t.Error("expected error removing the default registry")
+	}
+}
+
+func TestPinnedRegistries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := newGitRepo(t, filepath.Join(dir, "src"), "postgres")
+	r, err := git.PlainOpen(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateTag("v1.0.0", head.Hash(), nil); err != nil {
+		t.Fatal(err)
+	}
+	second := commitRecipes(t, src, "redis")
+
+	for _, ref := range []string{"v1.0.0", head.Hash().String()[:10], "master"} {
+		kr := &KbrewRegistry{path: filepath.Join(dir, ref)}
+		if _, err := kr.Add(src, ref); err != nil {
+			t.Fatalf("%s: failed to add registry: %v", ref, err)
+		}
+		reg, err := kr.Get("owner/repo")
+		if err != nil {
+			t.Fatalf("%s: failed to get registry: %v", ref, err)
+		}
+		want := head.Hash()
+		if ref == "master" {
+			want = second
+		}
+		if reg.Ref != ref || reg.Head != want.String() {
+			t.Errorf("%s: unexpected registry ref %s head %s, want head %s", ref, reg.Ref, reg.Head, want)
+		}
+	}
+
+	// Pinned tags and commits stay in place on update, pinned branches move to the latest commit
+	third := commitRecipes(t, src, "mysql")
+	for ref, want := range map[string]plumbing.Hash{
+		"v1.0.0":                  head.Hash(),
+		head.Hash().String()[:10]: head.Hash(),
+		"master":                  third,
+	} {
+		kr := &KbrewRegistry{path: filepath.Join(dir, ref)}
+		if err := kr.Update(); err != nil {
+			t.Fatalf("%s: failed to update registry: %v", ref, err)
+		}
+		reg, err := kr.Get("owner/repo")
+		if err != nil {
+			t.Fatalf("%s: failed to get registry: %v", ref, err)
+		}
+		if reg.Head != want.String() {
+			t.Errorf("%s: expected head %s after update, got %s", ref, want, reg.Head)
+		}
+	}
+
+	kr := &KbrewRegistry{path: filepath.Join(dir, "invalid")}
+	if _, err := kr.Add(src, "v9.9.9"); err == nil {
+		t.Error("expected error pinning registry to missing ref")
+	}
+	if list, _ := kr.List(); len(list) != 0 {
+		t.Errorf("expected registry not to be added with missing ref, got %v", list)
+	}
+}
+
+func TestRecipeResolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kr := &KbrewRegistry{path: filepath.Join(dir, registriesDirName)}
+	for reg, recipes := range map[string][]string{
+		"kbrew-dev/kbrew-registry": {"postgres", "redis"},
+		"acme/recipes":             {"postgres"},
+		"zeta/extra":               {"postgres", "mysql"},
+	} {
+		recipesDir := filepath.Join(kr.path, reg, "recipes")
+		if err := os.MkdirAll(recipesDir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range recipes {
+			if err := ioutil.WriteFile(filepath.Join(recipesDir, name+".yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	recipePath := func(reg, name string) string {
+		return filepath.Join(kr.path, reg, "recipes", name+".yaml")
+	}
+
+	for _, tc := range []struct {
+		priority   []string
+		registries []string
+		postgres   string
+	}{
+		{
+			registries: []string{"acme/recipes", "zeta/extra", "kbrew-dev/kbrew-registry"},
+			postgres:   "acme/recipes",
+		},
+		{
+			priority:   []string{"zeta/extra", "kbrew-dev/kbrew-registry"},
+			registries: []string{"zeta/extra", "kbrew-dev/kbrew-registry", "acme/recipes"},
+			postgres:   "zeta/extra",
+		},
+	} {
+		viper.Set("registryPriority", tc.priority)
+		list, err := kr.List()
+		if err != nil {
+			t.Fatalf("failed to list registries: %v", err)
+		}
+		if diff := cmp.Diff(tc.registries, list); diff != "" {
+			t.Errorf("List() mismatch (-want +got):\n%s", diff)
+		}
+		got, err := kr.FetchRecipe("postgres")
+		if err != nil {
+			t.Fatalf("failed to fetch recipe: %v", err)
+		}
+		if got != recipePath(tc.postgres, "postgres") {
+			t.Errorf("expected postgres recipe from %s, got %s", tc.postgres, got)
+		}
+		found, err := kr.Search("postgres", false)
+		if err != nil {
+			t.Fatalf("failed to search recipes: %v", err)
+		}
+		registries := []string{}
+		for _, info := range found {
+			registries = append(registries, info.Registry)
+		}
+		if diff := cmp.Diff(tc.registries, registries); diff != "" {
+			t.Errorf("Search() registries mismatch (-want +got):\n%s", diff)
+		}
+	}
+	viper.Set("registryPriority", nil)
+
+	got, err := kr.FetchRecipe("kbrew-dev/kbrew-registry/postgres")
+	if err != nil {
+		t.Fatalf("failed to fetch qualified recipe: %v", err)
+	}
+	if got != recipePath("kbrew-dev/kbrew-registry", "postgres") {
+		t.Errorf("unexpected recipe for qualified name %s", got)
+	}
+	if _, err := kr.FetchRecipe("acme/recipes/redis"); err == nil {
+		t.Error("expected error fetching recipe missing from the qualified registry")
+	}
+	if got, err := Lookup(dir, "mysql"); err != nil || got != recipePath("zeta/extra", "mysql") {
+		t.Errorf("unexpected lookup result %s, %v", got, err)
+	}
+	if AppName("acme/recipes/postgres") != "postgres" || AppName("postgres") != "postgres" {
+		t.Error("unexpected app name of the qualified name")
+	}
+}
+
+func TestConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbrew-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(source string) { defaultRegistrySource = source }(defaultRegistrySource)
+	// Clone the default registry from the local repo
+	defaultRegistrySource = filepath.Join(dir, "src", defaultRegistryUserName, defaultRegistryRepoName)
+	if _, err := git.PlainInit(defaultRegistrySource, false); err != nil {
+		t.Fatal(err)
+	}
+	commitRecipes(t, defaultRegistrySource, "postgres")
+	defer func(configDir string) { config.ConfigDir = configDir }(config.ConfigDir)
+	defer setEnv(map[string]string{config.HomeEnv: filepath.Join(dir, "home")})()
+
+	config.ConfigDir = ""
+	config.InitConfig()
+	if config.ConfigDir != filepath.Join(dir, "home") {
+		t.Fatalf("expected config dir from %s, got %s", config.HomeEnv, config.ConfigDir)
+	}
+	kr, err := New(config.ConfigDir)
+	if err != nil {
+		t.Fatalf("failed to init registries: %v", err)
+	}
+	registryDir := filepath.Join(dir, "home", registriesDirName, defaultRegistryUserName, defaultRegistryRepoName)
+	if _, err := os.Stat(filepath.Join(registryDir, ".git")); err != nil {
+		t.Errorf("default registry not cloned in the config dir: %v", err)
+	}
+	list, err := kr.List()
+	if err != nil {
+		t.Fatalf("failed to list registries: %v", err)
+	}
+	if diff := cmp.Diff([]string{"kbrew-dev/kbrew-registry"}, list); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+	if got, err := Lookup(config.ConfigDir, "postgres"); err != nil || got != filepath.Join(registryDir, "recipes", "postgres.yaml") {
+		t.Errorf("unexpected lookup result %s, %v", got, err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+	"github.com/kbrew-dev/kbrew/pkg/kube"
+)
+
+// Status describes the state of a kbrew release
+type Status string
+
+const (
+	// StatusDeployed means the app is installed successfully
+	StatusDeployed Status = "deployed"
+	// StatusFailed means the last operation on the app failed
+	StatusFailed Status = "failed"
+
+	// DefaultNamespace is the namespace holding kbrew release records
+	DefaultNamespace = "kbrew-system"
+
+	releaseKey        = "release"
+	releaseSecretType = "kbrew.dev/release.v1"
+	releaseNamePrefix = "kbrew.release.v1"
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	managedByValue    = "kbrew"
+	releaseNameLabel  = "kbrew.dev/release"
+	releaseNsLabel    = "kbrew.dev/namespace"
+)
+
+// ErrReleaseNotFound is returned when no release record exists for an app
+var ErrReleaseNotFound = errors.New("release not found")
+
+// Release is the record of an app installed by kbrew.
+// Explicit is set if the app was installed by the user and not only as a dependency of another app.
+type Release struct {
+	Name         string                 `json:"name"`
+	Namespace    string                 `json:"namespace"`
+	Version      string                 `json:"version,omitempty"`
+	Type         config.RepoType        `json:"type"`
+	Registry     string                 `json:"registry,omitempty"`
+	RecipeCommit string                 `json:"recipeCommit,omitempty"`
+	Status       Status                 `json:"status"`
+	Args         map[string]interface{} `json:"args,omitempty"`
+	Overrides    map[string]interface{} `json:"overrides,omitempty"`
+	Dependencies []string               `json:"dependencies,omitempty"`
+	Explicit     bool                   `json:"explicit,omitempty"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	UpdatedAt    time.Time              `json:"updatedAt"`
+}
+
+// Store persists kbrew release records as Secrets in the cluster
+type Store struct {
+	kubeCli   kubernetes.Interface
+	namespace string
+}
+
+// NewStore returns a release Store backed by Secrets in the DefaultNamespace
+func NewStore(kubeCli kubernetes.Interface) *Store {
+	return &Store{
+		kubeCli:   kubeCli,
+		namespace: DefaultNamespace,
+	}
+}
+
+// Get returns the release record of the app installed in the given namespace
+func (s *Store) Get(ctx context.Context, name, namespace string) (*Release, error) {
+	secret, err := s.kubeCli.CoreV1().Secrets(s.namespace).Get(ctx, secretName(name, namespace), metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, errors.Wrapf(err, "Failed to read release record for %s", name)
+	}
+	return decode(secret)
+}
+
+// Save creates or updates the release record
+func (s *Store) Save(ctx context.Context, rel *Release) error {
+	now := time.Now().UTC()
+	if rel.CreatedAt.IsZero() {
+		rel.CreatedAt = now
+	}
+	rel.UpdatedAt = now
+
+	data, err := json.Marshal(rel)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode release record for %s", rel.Name)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   secretName(rel.Name, rel.Namespace),
+			Labels: releaseLabels(rel.Name, rel.Namespace),
+		},
+		Type: releaseSecretType,
+		Data: map[string][]byte{releaseKey: data},
+	}
+
+	if err := kube.CreateNamespace(ctx, s.kubeCli, s.namespace); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "Failed to create %s namespace", s.namespace)
+	}
+	_, err = s.kubeCli.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = s.kubeCli.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	}
+	return errors.Wrapf(err, "Failed to save release record for %s", rel.Name)
+}
+
+// Delete removes the release record of the app installed in the given namespace
+func (s *Store) Delete(ctx context.Context, name, namespace string) error {
+	err := s.kubeCli.CoreV1().Secrets(s.namespace).Delete(ctx, secretName(name, namespace), metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.Wrapf(err, "Failed to delete release record for %s", name)
+	}
+	return nil
+}
+
+// List returns all the release records sorted by namespace and name
+func (s *Store) List(ctx context.Context) ([]Release, error) {
+	secrets, err := s.kubeCli.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{managedByLabel: managedByValue}.String(),
+	})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Failed to list release records")
+	}
+	releases := []Release{}
+	for i := range secrets.Items {
+		if secrets.Items[i].Type != releaseSecretType {
+			continue
+		}
+		rel, err := decode(&secrets.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, *rel)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Namespace != releases[j].Namespace {
+			return releases[i].Namespace < releases[j].Namespace
+		}
+		return releases[i].Name < releases[j].Name
+	})
+	return releases, nil
+}
+
+// Dependents returns the release records of the apps which have the given app as a dependency
+func (s *Store) Dependents(ctx context.Context, name string) ([]Release, error) {
+	releases, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dependents := []Release{}
+	for _, rel := range releases {
+		for _, dep := range rel.Dependencies {
+			if dep == name {
+				dependents = append(dependents, rel)
+				break
+			}
+		}
+	}
+	return dependents, nil
+}
+
+func decode(secret *corev1.Secret) (*Release, error) {
+	rel := &Release{}
+	if err := json.Unmarshal(secret.Data[releaseKey], rel); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode release record %s", secret.GetName())
+	}
+	return rel, nil
+}
+
+// secretName returns name of the Secret holding release record.
+// Cluster scoped apps are installed with empty namespace.
+func secretName(name, namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s.%s", releaseNamePrefix, name)
+	}
+	return fmt.Sprintf("%s.%s.%s", releaseNamePrefix, name, namespace)
+}
+
+func releaseLabels(name, namespace string) map[string]string {
+	l := map[string]string{
+		managedByLabel:   managedByValue,
+		releaseNameLabel: name,
+	}
+	if namespace != "" {
+		l[releaseNsLabel] = namespace
+	}
+	return l
+}
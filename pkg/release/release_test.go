@@ -0,0 +1,98 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kbrew-dev/kbrew/pkg/config"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(fake.NewSimpleClientset())
+
+	if _, err := s.Get(ctx, "kafka-operator", "kafka"); err != ErrReleaseNotFound {
+		t.Fatalf("expected ErrReleaseNotFound, got %v", err)
+	}
+
+	releases := []*Release{
+		{
+			Name:         "kafka-operator",
+			Namespace:    "kafka",
+			Version:      "0.22.0",
+			Type:         config.Helm,
+			Status:       StatusDeployed,
+			Dependencies: []string{"cert-manager"},
+		},
+		{
+			Name:   "cert-manager",
+			Type:   config.Raw,
+			Status: StatusDeployed,
+			Args:   map[string]interface{}{"Deployment.cert-manager.spec.replicas": float64(2)},
+		},
+	}
+	for _, rel := range releases {
+		if err := s.Save(ctx, rel); err != nil {
+			t.Fatalf("failed to save release %s: %v", rel.Name, err)
+		}
+	}
+
+	got, err := s.Get(ctx, "kafka-operator", "kafka")
+	if err != nil {
+		t.Fatalf("failed to get release: %v", err)
+	}
+	if diff := cmp.Diff(releases[0], got, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("Get() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Update existing record
+	got.Status = StatusFailed
+	if err := s.Save(ctx, got); err != nil {
+		t.Fatalf("failed to update release: %v", err)
+	}
+
+	list, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list releases: %v", err)
+	}
+	names := []string{}
+	for _, rel := range list {
+		names = append(names, rel.Name+"/"+string(rel.Status))
+	}
+	if diff := cmp.Diff([]string{"cert-manager/deployed", "kafka-operator/failed"}, names); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+
+	dependents, err := s.Dependents(ctx, "cert-manager")
+	if err != nil {
+		t.Fatalf("failed to list dependents: %v", err)
+	}
+	if len(dependents) != 1 || dependents[0].Name != "kafka-operator" {
+		t.Errorf("expected kafka-operator as the only dependent of cert-manager, got %v", dependents)
+	}
+
+	if err := s.Delete(ctx, "cert-manager", ""); err != nil {
+		t.Fatalf("failed to delete release: %v", err)
+	}
+	if _, err := s.Get(ctx, "cert-manager", ""); err != ErrReleaseNotFound {
+		t.Fatalf("expected ErrReleaseNotFound after delete, got %v", err)
+	}
+}
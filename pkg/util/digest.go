@@ -0,0 +1,90 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const sha256Prefix = "sha256:"
+
+// ErrDigestMismatch is returned when the digest of the downloaded content does not match the expected digest
+var ErrDigestMismatch = errors.New("sha256 digest mismatch")
+
+// SHA256 returns hex encoded sha256 digest of the content read from r
+func SHA256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", errors.Wrap(err, "Failed to compute sha256 digest")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySHA256 checks the sha256 digest of the data against the expected hex encoded digest.
+// The expected digest may have the "sha256:" prefix. Verification is skipped if the expected digest is empty.
+func VerifySHA256(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	got, err := SHA256(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	want := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(expected), sha256Prefix))
+	if got != want {
+		return errors.Wrapf(ErrDigestMismatch, "expected %s, got %s", want, got)
+	}
+	return nil
+}
+
+// FetchURL downloads the content of the URL
+func FetchURL(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to fetch %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Failed to fetch %s: %s", url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Wrapf(err, "Failed to fetch %s", url)
+}
+
+// Digest returns the sha256 digest of the content at the location which can be a http(s) URL or a file path
+func Digest(location string) (string, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err := FetchURL(location)
+		if err != nil {
+			return "", err
+		}
+		return SHA256(bytes.NewReader(data))
+	}
+	f, err := os.Open(location)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to open %s", location)
+	}
+	defer f.Close()
+	return SHA256(f)
+}
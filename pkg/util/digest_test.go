@@ -0,0 +1,53 @@
+// Copyright 2021 The kbrew Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestVerifySHA256(t *testing.T) {
+	// sha256 digest of "kbrew"
+	const digest = "8b5515cd905e973e84aa0e5a6cade46065f173efeafa588d58c030ffd4d957a3"
+
+	cases := map[string]struct {
+		expected string
+		wantErr  bool
+	}{
+		"matching digest":        {expected: digest},
+		"matching with prefix":   {expected: "sha256:" + digest},
+		"matching uppercase":     {expected: "8B5515CD905E973E84AA0E5A6CADE46065F173EFEAFA588D58C030FFD4D957A3"},
+		"no digest set":          {expected: ""},
+		"mismatching digest":     {expected: "0000000000000000000000000000000000000000000000000000000000000000", wantErr: true},
+		"digest of other format": {expected: "md5:foo", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := VerifySHA256([]byte("kbrew"), tc.expected)
+			if tc.wantErr {
+				if !errors.Is(err, ErrDigestMismatch) {
+					t.Fatalf("expected digest mismatch error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}